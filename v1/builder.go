@@ -0,0 +1,133 @@
+package hclpath
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kdehairy/hclpath/v2/parse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Builder builds a query in Go, producing the same AST the parser would, so
+// that values never go through query text and need no quoting. Builders are
+// immutable: every method returns a new Builder, leaving its receiver usable.
+// Errors are reported by Expr and Compile.
+type Builder struct {
+	expr parse.Expr
+	err  error
+}
+
+// Type starts a query with the top level blocks of type name.
+func Type(name string) *Builder {
+	return &Builder{expr: parse.NewIdent(parse.Type, name)}
+}
+
+// Root starts a query with the node it is executed against, like `.`, so that
+// its own attributes may be filtered or projected.
+func Root() *Builder {
+	return &Builder{expr: parse.NewIdent(parse.Root, ".")}
+}
+
+func (b *Builder) with(op parse.Op, rhs parse.Expr, err error) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if err != nil {
+		return &Builder{err: err}
+	}
+	return &Builder{expr: parse.NewBinOp(op, b.expr, rhs)}
+}
+
+// Label keeps the blocks having name among their labels, like `:`.
+func (b *Builder) Label(name string) *Builder {
+	return b.with(parse.LblOp, parse.NewIdent(parse.Label, name), nil)
+}
+
+// Child moves to the child blocks of type name, like `/`.
+func (b *Builder) Child(typeName string) *Builder {
+	return b.with(parse.NstOp, parse.NewIdent(parse.Type, typeName), nil)
+}
+
+// Into moves into the modules called by the blocks, to their top level blocks
+// of type name, like `/>>`.
+func (b *Builder) Into(typeName string) *Builder {
+	return b.with(parse.EntOp, parse.NewIdent(parse.Type, typeName), nil)
+}
+
+// Attribute moves to the attribute called name of the blocks, like `/@`.
+func (b *Builder) Attribute(name string) *Builder {
+	return b.with(parse.PrjOp, parse.NewIdent(parse.Attr, name), nil)
+}
+
+// Index keeps the block at index i, like `[i]`.
+func (b *Builder) Index(i int) *Builder {
+	return b.with(parse.SelOp, parse.NewNumLt(i), nil)
+}
+
+// Where keeps the blocks matching p, like `{}`.
+func (b *Builder) Where(p *Predicate) *Builder {
+	return b.with(parse.FltOp, p.expr, p.err)
+}
+
+// Expr returns the AST built so far.
+func (b *Builder) Expr() (parse.Expr, error) {
+	return b.expr, b.err
+}
+
+// Compile compiles the query without going through its text.
+func (b *Builder) Compile(opts ...Option) (*Compilation, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return CompileExpr(b.expr, opts...)
+}
+
+// String returns the query text of the builder, or an empty string when it
+// cannot be formatted.
+func (b *Builder) String() string {
+	if b.err != nil {
+		return ""
+	}
+	str, _ := parse.Format(b.expr)
+	return str
+}
+
+// Predicate is a condition on the attributes of a block, for use with Where.
+type Predicate struct {
+	expr parse.Expr
+	err  error
+}
+
+// Attr matches the blocks having an attribute called name.
+func Attr(name string) *Predicate {
+	return &Predicate{expr: parse.NewIdent(parse.Attr, name)}
+}
+
+// Eq matches the blocks whose attribute equals val, which must be a known,
+// non null string or number.
+func (p *Predicate) Eq(val cty.Value) *Predicate {
+	if p.err != nil {
+		return p
+	}
+	if p.expr.GetOp() != nil {
+		return &Predicate{err: errors.New("predicate already has a value")}
+	}
+	lt, err := literal(val)
+	if err != nil {
+		return &Predicate{err: err}
+	}
+	return &Predicate{expr: parse.NewBinOp(parse.EqlOp, p.expr, parse.NewStrLt(lt))}
+}
+
+func literal(val cty.Value) (string, error) {
+	if val.IsNull() || !val.IsKnown() {
+		return "", errors.New("expected a known, non null value")
+	}
+	switch val.Type() {
+	case cty.String:
+		return val.AsString(), nil
+	case cty.Number:
+		return val.AsBigFloat().Text('f', -1), nil
+	}
+	return "", fmt.Errorf("cannot compare attributes to values of type %v", val.Type().FriendlyName())
+}
@@ -0,0 +1,120 @@
+package hclpath
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"github.com/kdehairy/hclpath/v2/parse"
+)
+
+// CompileCache keeps the most recently used compilations, keyed on their
+// query text, so that hot queries are only compiled once. Equivalent
+// spellings of a query share a compilation. It is safe for concurrent use.
+type CompileCache struct {
+	size int
+	opts []Option
+
+	mu sync.Mutex
+	// entries holds each cached compilation under its normalized query text
+	// and under every spelling it was looked up with.
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	keys        []string
+	compilation *Compilation
+}
+
+// NewCompileCache returns a cache holding up to size compilations, each
+// compiled with opts. The least recently used compilation is evicted first.
+// A size below 1 disables caching.
+func NewCompileCache(size int, opts ...Option) *CompileCache {
+	return &CompileCache{
+		size:    size,
+		opts:    opts,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Compile returns the cached compilation of path, compiling it on a miss.
+// Failed compilations are not cached.
+func (c *CompileCache) Compile(path string) (*Compilation, error) {
+	if c.size < 1 {
+		return Compile(path, c.opts...)
+	}
+	if compilation, ok := c.hit(path, path); ok {
+		return compilation, nil
+	}
+
+	// only a miss pays for parsing, to find the normalized text and to
+	// compile.
+	expr, err := parse.NewParser(strings.NewReader(path)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	key, err := parse.Format(expr)
+	if err != nil {
+		key = path
+	}
+	if compilation, ok := c.hit(key, path); ok {
+		return compilation, nil
+	}
+	compilation, err := compileExpr(newConfig(c.opts), expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// compiled concurrently by another caller.
+		c.addKey(e, path)
+		c.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).compilation, nil
+	}
+	e := c.order.PushFront(&cacheEntry{keys: []string{key}, compilation: compilation})
+	c.entries[key] = e
+	c.addKey(e, path)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		for _, k := range oldest.Value.(*cacheEntry).keys {
+			delete(c.entries, k)
+		}
+	}
+	return compilation, nil
+}
+
+// hit returns the compilation cached under key, marking it as the most
+// recently used, and caches it under path as well.
+func (c *CompileCache) hit(key, path string) (*Compilation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.addKey(e, path)
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).compilation, true
+}
+
+// addKey caches the entry e under key as well. c.mu must be held.
+func (c *CompileCache) addKey(e *list.Element, key string) {
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = e
+	entry := e.Value.(*cacheEntry)
+	entry.keys = append(entry.keys, key)
+}
+
+// Len returns the number of cached compilations.
+func (c *CompileCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
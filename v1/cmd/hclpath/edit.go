@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kdehairy/hclpath/v2"
+	"github.com/kdehairy/hclpath/v2/diff"
+)
+
+// commands are the editing subcommands, along with their arguments.
+var commands = map[string]string{
+	"set":    "QUERY ATTR EXPR",
+	"rm":     "QUERY",
+	"rename": "QUERY NAME",
+}
+
+// editFile is a file loaded for editing.
+type editFile struct {
+	name string
+	// src is the content of the file as read.
+	src  []byte
+	file *hclwrite.File
+}
+
+// runEdit runs the editing subcommand cmd.
+func runEdit(cmd string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	usage := fmt.Sprintf("usage: hclpath %v [flags] %v [FILE|DIR]...", cmd, commands[cmd])
+	flags := flag.NewFlagSet("hclpath "+cmd, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		flags.PrintDefaults()
+	}
+	ignoreCase := flags.Bool("i", false, "match block types, labels and attribute names regardless of case")
+	lenient := flags.Bool("lenient", false, "skip anomalies in the files, rather than failing")
+	recursive := flags.Bool("r", false, "search directories recursively")
+	write := flags.Bool("w", false, "write the edited files in place")
+	showDiff := flags.Bool("d", false, "print the changes as unified diffs")
+	check := flags.Bool("check", false, "list the files that would change, and exit with 1 if any would")
+	var label *int
+	var renameType, refs *bool
+	if cmd == "rename" {
+		label = flags.Int("label", 0, "`index` of the label to rename")
+		renameType = flags.Bool("type", false, "rename the block type, rather than a label")
+		refs = flags.Bool("refs", false, "also rewrite the references to renamed blocks in all the files")
+	}
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitMatch
+		}
+		return exitError
+	}
+	want := len(strings.Fields(commands[cmd]))
+	if len(positional) < want {
+		flags.Usage()
+		return exitError
+	}
+	if *write && *check {
+		fmt.Fprintln(stderr, "hclpath: -w and -check cannot be used together")
+		return exitError
+	}
+
+	opts := []hclpath.Option{}
+	if *ignoreCase {
+		opts = append(opts, hclpath.WithIgnoreCase())
+	}
+	if *lenient {
+		opts = append(opts, hclpath.WithMode(hclpath.Lenient))
+	}
+
+	paths := positional[want:]
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	files, err := loadFiles(paths, *recursive, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "hclpath: %v\n", err)
+		return exitError
+	}
+	if *write {
+		for _, f := range files {
+			if f.name == "-" {
+				fmt.Fprintln(stderr, "hclpath: cannot write the standard input in place")
+				return exitError
+			}
+		}
+	}
+
+	query := positional[0]
+	var edit func(*hclwrite.File) error
+	switch cmd {
+	case "set":
+		edit = func(f *hclwrite.File) error {
+			_, err := hclpath.SetExpr(f, query, positional[1], positional[2], opts...)
+			return err
+		}
+	case "rm":
+		edit = func(f *hclwrite.File) error {
+			_, err := hclpath.Remove(f, query, opts...)
+			return err
+		}
+	case "rename":
+		if *refs {
+			all := make([]*hclwrite.File, 0, len(files))
+			for _, f := range files {
+				all = append(all, f.file)
+			}
+			opts = append(opts, hclpath.WithReferences(all...))
+		}
+		edit = func(f *hclwrite.File) error {
+			var err error
+			if *renameType {
+				_, err = hclpath.RenameType(f, query, positional[1], opts...)
+			} else {
+				_, err = hclpath.RenameLabel(f, query, *label, positional[1], opts...)
+			}
+			return err
+		}
+	}
+	// every file is edited before any is written, so that an error leaves
+	// them all untouched.
+	for _, f := range files {
+		if err := edit(f.file); err != nil {
+			fmt.Fprintf(stderr, "hclpath: failed to edit file '%v': %v\n", displayName(f.name), err)
+			return exitError
+		}
+	}
+
+	status := exitMatch
+	for _, f := range files {
+		after := hclpath.Bytes(f.file)
+		changed := !bytes.Equal(f.src, after)
+		if changed && *check {
+			status = exitNoMatch
+			if !*showDiff {
+				fmt.Fprintln(stdout, displayName(f.name))
+			}
+		}
+		if changed && *showDiff {
+			fmt.Fprint(stdout, diff.Unified("a/"+displayName(f.name), "b/"+displayName(f.name), f.src, after))
+		}
+		if changed && *write {
+			if err := writeFile(f.name, after); err != nil {
+				fmt.Fprintf(stderr, "hclpath: %v\n", err)
+				status = exitError
+			}
+		}
+		if !*write && !*showDiff && !*check {
+			stdout.Write(after)
+		}
+	}
+	return status
+}
+
+// parseArgs parses args with flags, allowing flags after the positional
+// arguments, up to a `--`, and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// loadFiles reads the native syntax files of paths for editing. JSON files
+// cannot be edited, and are skipped in directories.
+func loadFiles(paths []string, recursive bool, stdin io.Reader) ([]*editFile, error) {
+	files := []*editFile{}
+	for _, path := range paths {
+		names, err := expand(path, recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if strings.HasSuffix(name, ".json") {
+				if name == path {
+					return nil, fmt.Errorf("cannot edit JSON file '%v'", name)
+				}
+				continue
+			}
+			var src []byte
+			if name == "-" {
+				src, err = io.ReadAll(stdin)
+			} else {
+				src, err = os.ReadFile(name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file '%v': %v", displayName(name), err)
+			}
+			file, diags := hclwrite.ParseConfig(src, displayName(name), hcl.InitialPos)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("failed to parse file '%v': %v", displayName(name), diags)
+			}
+			files = append(files, &editFile{name: name, src: src, file: file})
+		}
+	}
+	return files, nil
+}
+
+// writeFile replaces the content of the file name, keeping its permissions.
+func writeFile(name string, content []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, content, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write file '%v': %v", name, err)
+	}
+	return nil
+}
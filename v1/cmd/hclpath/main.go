@@ -0,0 +1,249 @@
+// Command hclpath prints the blocks of HCL files that match a query.
+//
+// Usage:
+//
+//	hclpath [flags] QUERY [FILE|DIR]...
+//
+// Directories are searched for .tf, .tfvars and .hcl files, and their JSON
+// variants. With no file, or with '-', the native syntax is read from the
+// standard input.
+//
+// Matches are printed as `file:line: type "label"...`, or with -output:
+//   - json: a JSON array of the matches, with their type, labels, range, and
+//     attributes as cty JSON,
+//   - hcl: the source of every match,
+//   - loc: `file:line:col`, for editors and grep tooling.
+//
+// With -format, matches are printed through a text/template template, such as
+// '{{.Type}} {{index .Labels 0}} {{attr "region"}}'. Templates are executed
+// on the File, Type, Labels and Range of every match, and may call attr and
+// expr for the value and the source of an attribute, file for the file name
+// and srcRange for the range of the match.
+//
+// With -count, only the number of matches is printed.
+//
+// Like grep, hclpath exits with 0 when something matched, 1 when nothing did,
+// and 2 on any error.
+//
+// Directories are only searched recursively with -r, or when given as
+// `dir/...`.
+//
+// # Editing
+//
+// The set, rm and rename subcommands edit the files matched by a query:
+//
+//	hclpath set [flags] QUERY ATTR EXPR [FILE|DIR]...
+//	hclpath rm [flags] QUERY [FILE|DIR]...
+//	hclpath rename [flags] QUERY NAME [FILE|DIR]...
+//
+// set sets the attribute ATTR of the matched blocks to the expression EXPR.
+// ATTR may be a path into an object, such as aws.version in
+//
+//	hclpath set terraform/required_providers aws.version '">= 5.20"' -w ./...
+//
+// rm removes the matched blocks, or attributes with a query such as
+// 'provider:aws/@alias'. rename renames the label at -label of the matched
+// blocks, or their type with -type, and with -refs also rewrites the
+// references to them in all the files.
+//
+// Like gofmt, the edited files are printed, unless one of these flags is given:
+//   - -w: write the changes in place,
+//   - -d: print the changes as unified diffs,
+//   - -check: list the files that would change, or with -d print their diffs,
+//     and exit with 1 if any would.
+//
+// Flags may also follow the arguments. Only the edited lines come out
+// formatted, and only native syntax files can be edited; JSON files are
+// skipped in directories. To query blocks of type set, rm or rename, quote the
+// type, as in '"set"'.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/kdehairy/hclpath/v2"
+)
+
+const (
+	exitMatch   = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// stdinName is the name matches read from the standard input are reported
+// under.
+const stdinName = "(standard input)"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			return runEdit(args[0], args[1:], stdin, stdout, stderr)
+		}
+	}
+	flags := flag.NewFlagSet("hclpath", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: hclpath [flags] QUERY [FILE|DIR]...")
+		flags.PrintDefaults()
+	}
+	ignoreCase := flags.Bool("i", false, "match block types, labels and attribute names regardless of case")
+	lenient := flags.Bool("lenient", false, "skip anomalies in the files, rather than failing")
+	recursive := flags.Bool("r", false, "search directories recursively")
+	output := flags.String("output", "text", "output `format`: text, json, hcl or loc")
+	format := flags.String("format", "", "print matches through a text/template `template`, overriding -output")
+	count := flags.Bool("count", false, "only print the number of matches")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitMatch
+		}
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	opts := []hclpath.Option{}
+	if *ignoreCase {
+		opts = append(opts, hclpath.WithIgnoreCase())
+	}
+	if *lenient {
+		opts = append(opts, hclpath.WithMode(hclpath.Lenient))
+	}
+	compilation, err := hclpath.Compile(flags.Arg(0), opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "hclpath: %v\n", err)
+		return exitError
+	}
+	p, err := newPrinter(stdout, *output, *format, *count)
+	if err != nil {
+		fmt.Fprintf(stderr, "hclpath: %v\n", err)
+		return exitError
+	}
+
+	paths := flags.Args()[1:]
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	status := exitNoMatch
+	fail := func(err error) {
+		fmt.Fprintf(stderr, "hclpath: %v\n", err)
+		status = exitError
+	}
+	parser := hclparse.NewParser()
+	for _, path := range paths {
+		names, err := expand(path, *recursive)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		for _, name := range names {
+			file, err := parseFile(parser, name, stdin)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			nodes, err := compilation.Exec(hclpath.Nodes{hclpath.NewNode(file.Body)})
+			if err != nil {
+				fail(fmt.Errorf("failed to query file '%v': %v", displayName(name), err))
+				continue
+			}
+			for _, n := range nodes {
+				if err := p.print(match{file: displayName(name), node: n, src: file.Bytes}); err != nil {
+					fail(err)
+				}
+			}
+			if len(nodes) > 0 && status == exitNoMatch {
+				status = exitMatch
+			}
+		}
+	}
+	if err := p.flush(); err != nil {
+		fail(err)
+	}
+	return status
+}
+
+// expand lists the configuration files of path when it is a directory, and
+// path itself otherwise. A path of the form `dir/...` lists the files of dir
+// recursively.
+func expand(path string, recursive bool) ([]string, error) {
+	if path == "-" {
+		return []string{path}, nil
+	}
+	if path == "..." || strings.HasSuffix(path, "/...") {
+		path = strings.TrimSuffix(strings.TrimSuffix(path, "..."), "/")
+		if path == "" {
+			path = "."
+		}
+		recursive = true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	names := []string{}
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != path && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hclpath.IsConfigFile(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func parseFile(parser *hclparse.Parser, name string, stdin io.Reader) (*hcl.File, error) {
+	var src []byte
+	var err error
+	if name == "-" {
+		src, err = io.ReadAll(stdin)
+	} else {
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file '%v': %v", displayName(name), err)
+	}
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(name, ".json") {
+		file, diags = parser.ParseJSON(src, name)
+	} else {
+		file, diags = parser.ParseHCL(src, displayName(name))
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file '%v': %v", displayName(name), diags)
+	}
+	return file, nil
+}
+
+func displayName(name string) string {
+	if name == "-" {
+		return stdinName
+	}
+	return name
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tf":               "provider \"aws\" {\n  region = \"eu-west-1\"\n}\n",
+		"prod.tfvars":           "region = \"eu-west-1\"\n",
+		"README.md":             "provider \"aws\" {}\n",
+		"modules/app/main.tf":   "provider \"aws\" {}\n",
+		"broken.tf":             "provider \"aws\" {\n",
+		"json/versions.tf.json": `{"terraform": {"required_providers": {"aws": {"version": "1"}}}}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainTF := filepath.Join(dir, "main.tf")
+	app := filepath.Join(dir, "modules", "app", "main.tf")
+	broken := filepath.Join(dir, "broken.tf")
+	versions := filepath.Join(dir, "json", "versions.tf.json")
+
+	cases := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+		status   int
+	}{
+		{
+			name:     "file",
+			args:     []string{"provider:aws", mainTF},
+			expected: mainTF + ":1: provider \"aws\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "directory",
+			args:     []string{"provider:aws", filepath.Dir(app)},
+			expected: app + ":1: provider \"aws\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "recursive",
+			args:     []string{"-r", "provider", filepath.Dir(filepath.Dir(app))},
+			expected: app + ":1: provider \"aws\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "recursive pattern",
+			args:     []string{"provider", filepath.Dir(filepath.Dir(app)) + "/..."},
+			expected: app + ":1: provider \"aws\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "terraform json",
+			args:     []string{"terraform/required_providers", versions},
+			expected: versions + ":1: required_providers\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "ignore case",
+			args:     []string{"-i", "PROVIDER:AWS", mainTF},
+			expected: mainTF + ":1: provider \"aws\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "stdin",
+			args:     []string{"/@region"},
+			stdin:    "region = \"eu-west-1\"\n",
+			expected: "(standard input):1: @region\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "no match",
+			args:     []string{"provider:google", mainTF},
+			expected: "",
+			status:   exitNoMatch,
+		},
+		{
+			name:     "syntax error",
+			args:     []string{"provider:", mainTF},
+			expected: "",
+			status:   exitError,
+		},
+		{
+			name:     "missing file",
+			args:     []string{"provider", filepath.Join(dir, "missing.tf")},
+			expected: "",
+			status:   exitError,
+		},
+		{
+			name:     "error in one of the files",
+			args:     []string{"provider", broken, mainTF},
+			expected: mainTF + ":1: provider \"aws\"\n",
+			status:   exitError,
+		},
+		{
+			name:     "missing query",
+			args:     []string{},
+			expected: "",
+			status:   exitError,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+			if status != tc.status {
+				t.Errorf("Expected status '%v' but found '%v': %v", tc.status, status, stderr.String())
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("directory_of_the_root", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		status := run([]string{"/@region", dir}, nil, &stdout, &stderr)
+		expected := filepath.Join(dir, "prod.tfvars") + ":1: @region\n"
+		if status != exitError {
+			t.Errorf("Expected status '%v' but found '%v'", exitError, status)
+		}
+		if stdout.String() != expected {
+			t.Errorf("Expected '%v' but found '%v'", expected, stdout.String())
+		}
+	})
+}
+
+func TestOutput(t *testing.T) {
+	dir := t.TempDir()
+	mainTF := filepath.Join(dir, "main.tf")
+	src := `terraform {
+  required_providers {
+    aws = {
+      version = ">= 5.11.0"
+    }
+  }
+}
+
+provider "aws" {
+  alias  = "west"
+  region = var.region
+}
+`
+	if err := os.WriteFile(mainTF, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mainJSON := filepath.Join(dir, "main.tf.json")
+	if err := os.WriteFile(mainJSON, []byte(`{"provider": {"aws": {"region": "eu-west-1"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+		status   int
+	}{
+		{
+			name: "json",
+			args: []string{"-output=json", "provider:aws", mainTF},
+			expected: `[
+  {
+    "file": "` + mainTF + `",
+    "type": "provider",
+    "labels": [
+      "aws"
+    ],
+    "range": {
+      "start": {
+        "line": 9,
+        "column": 1,
+        "byte": 88
+      },
+      "end": {
+        "line": 12,
+        "column": 2,
+        "byte": 146
+      }
+    },
+    "attributes": {
+      "alias": "west"
+    },
+    "expressions": {
+      "region": "var.region"
+    }
+  }
+]
+`,
+			status: exitMatch,
+		},
+		{
+			name:     "json without matches",
+			args:     []string{"--output=json", "module", mainTF},
+			expected: "[]\n",
+			status:   exitNoMatch,
+		},
+		{
+			name: "hcl",
+			args: []string{"--output=hcl", "terraform/required_providers", mainTF},
+			expected: `  required_providers {
+    aws = {
+      version = ">= 5.11.0"
+    }
+  }
+
+`,
+			status: exitMatch,
+		},
+		{
+			name:     "hcl attribute",
+			args:     []string{"--output=hcl", "provider/@alias", mainTF},
+			expected: "  alias  = \"west\"\n\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "hcl from json",
+			args:     []string{"--output=hcl", "provider", mainJSON},
+			expected: "",
+			status:   exitError,
+		},
+		{
+			name:     "loc",
+			args:     []string{"--output=loc", "terraform/required_providers", mainTF},
+			expected: mainTF + ":2:3\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "count",
+			args:     []string{"--count", "provider", mainTF, mainJSON},
+			expected: "2\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "count without matches",
+			args:     []string{"--count", "module", mainTF},
+			expected: "0\n",
+			status:   exitNoMatch,
+		},
+		{
+			name:     "unknown output",
+			args:     []string{"--output=yaml", "provider", mainTF},
+			expected: "",
+			status:   exitError,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tc.args, nil, &stdout, &stderr)
+			if status != tc.status {
+				t.Errorf("Expected status '%v' but found '%v': %v", tc.status, status, stderr.String())
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	dir := t.TempDir()
+	mainTF := filepath.Join(dir, "main.tf")
+	src := `provider "aws" {
+  alias   = "west"
+  region  = var.region
+  retries = 3
+  tags    = { team = "platform" }
+}
+`
+	if err := os.WriteFile(mainTF, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		format   string
+		test     string
+		expected string
+		status   int
+	}{
+		{
+			name:     "fields",
+			format:   `{{.Type}} {{index .Labels 0}} {{.Range.Start.Line}}-{{.Range.End.Line}}`,
+			test:     "provider",
+			expected: "provider aws 1-6\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "attributes",
+			format:   `{{attr "alias"}} {{attr "retries"}} {{attr "tags"}} {{attr "missing"}}`,
+			test:     "provider",
+			expected: "west 3 {\"team\":\"platform\"} \n",
+			status:   exitMatch,
+		},
+		{
+			name:     "attribute that does not evaluate",
+			format:   `{{attr "region"}} {{expr "alias"}}`,
+			test:     "provider",
+			expected: "var.region \"west\"\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "projected attribute",
+			format:   `{{.Type}}={{attr "alias"}}`,
+			test:     "provider/@alias",
+			expected: "@alias=west\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "file and range",
+			format:   `{{file}}:{{(srcRange).Start.Line}}:{{(srcRange).Start.Column}}`,
+			test:     "provider/@retries",
+			expected: mainTF + ":4:3\n",
+			status:   exitMatch,
+		},
+		{
+			name:     "invalid template",
+			format:   `{{.Type`,
+			test:     "provider",
+			expected: "",
+			status:   exitError,
+		},
+		{
+			name:     "failing template",
+			format:   `{{index .Labels 3}}`,
+			test:     "provider",
+			expected: "",
+			status:   exitError,
+		},
+		{
+			name:     "template failing after some output",
+			format:   `{{.Type}} {{index .Labels 3}}`,
+			test:     "provider",
+			expected: "",
+			status:   exitError,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run([]string{"--format", tc.format, tc.test, mainTF}, nil, &stdout, &stderr)
+			if status != tc.status {
+				t.Errorf("Expected status '%v' but found '%v': %v", tc.status, status, stderr.String())
+			}
+			if stdout.String() != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const mainSrc = `terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.11.0"
+    }
+  }
+}
+
+variable "region" {}
+
+provider "aws" {
+  region = var.region
+}
+
+locals { zone    = "a" }
+`
+	const varsSrc = "region = \"eu-west-1\"\n"
+	bumped := strings.Replace(mainSrc, `">= 5.11.0"`, `">= 5.20"`, 1)
+	renamed := strings.Replace(strings.Replace(mainSrc,
+		`variable "region"`, `variable "aws_region"`, 1),
+		`var.region`, `var.aws_region`, 1)
+
+	cases := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+		status   int
+		// files holds the expected content of main.tf and vars.tfvars after the
+		// run.
+		files [2]string
+	}{
+		{
+			name:     "set in place",
+			args:     []string{"set", "terraform/required_providers", "aws.version", `">= 5.20"`, "-w", "DIR/..."},
+			expected: "",
+			status:   exitMatch,
+			files:    [2]string{bumped, varsSrc},
+		},
+		{
+			name:     "set from stdin",
+			args:     []string{"set", ".", "region", `"us-east-1"`},
+			stdin:    varsSrc,
+			expected: "region = \"us-east-1\"\n",
+			status:   exitMatch,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name: "diff",
+			args: []string{"set", "-d", "terraform/required_providers", "aws.version", `">= 5.20"`, "DIR/main.tf"},
+			expected: `--- a/DIR/main.tf
++++ b/DIR/main.tf
+@@ -2,7 +2,7 @@
+   required_providers {
+     aws = {
+       source  = "hashicorp/aws"
+-      version = ">= 5.11.0"
++      version = ">= 5.20"
+     }
+   }
+ }
+`,
+			status: exitMatch,
+			files:  [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "check with changes",
+			args:     []string{"set", "terraform/required_providers", "aws.version", `">= 5.20"`, "--check", "DIR"},
+			expected: "DIR/main.tf\n",
+			status:   exitNoMatch,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "check without changes",
+			args:     []string{"set", "terraform/required_providers", "aws.version", `">= 5.11.0"`, "--check", "DIR"},
+			expected: "",
+			status:   exitMatch,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "remove",
+			args:     []string{"rm", "-w", "/@region", "DIR/vars.tfvars"},
+			expected: "",
+			status:   exitMatch,
+			files:    [2]string{mainSrc, ""},
+		},
+		{
+			name:     "rename with references",
+			args:     []string{"rename", "-w", "-refs", "variable:region", "aws_region", "DIR"},
+			expected: "",
+			status:   exitMatch,
+			files:    [2]string{renamed, varsSrc},
+		},
+		{
+			name:     "rename type",
+			args:     []string{"rename", "-type", "variable", "input", "DIR/main.tf"},
+			expected: strings.Replace(mainSrc, `variable "region"`, `input "region"`, 1),
+			status:   exitMatch,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "flags after a double dash",
+			args:     []string{"rm", "provider", "--", "-w"},
+			expected: "",
+			status:   exitError,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "write stdin",
+			args:     []string{"rm", "-w", "provider"},
+			stdin:    mainSrc,
+			expected: "",
+			status:   exitError,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "invalid edit",
+			args:     []string{"set", "-w", "provider", "region", `"x`, "DIR"},
+			expected: "",
+			status:   exitError,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "json file",
+			args:     []string{"rm", "provider", "DIR/main.tf.json"},
+			expected: "",
+			status:   exitError,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+		{
+			name:     "missing arguments",
+			args:     []string{"set", "provider", "region"},
+			expected: "",
+			status:   exitError,
+			files:    [2]string{mainSrc, varsSrc},
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			dir := t.TempDir()
+			names := [2]string{filepath.Join(dir, "main.tf"), filepath.Join(dir, "vars.tfvars")}
+			srcs := map[string]string{
+				names[0]:                           mainSrc,
+				names[1]:                           varsSrc,
+				filepath.Join(dir, "main.tf.json"): `{"provider": {"aws": {}}}`,
+			}
+			for name, src := range srcs {
+				if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := make([]string, len(tc.args))
+			for i, arg := range tc.args {
+				args[i] = strings.Replace(arg, "DIR", dir, 1)
+			}
+
+			var stdout, stderr bytes.Buffer
+			status := run(args, strings.NewReader(tc.stdin), &stdout, &stderr)
+			if status != tc.status {
+				t.Errorf("Expected status '%v' but found '%v': %v", tc.status, status, stderr.String())
+			}
+			expected := strings.ReplaceAll(tc.expected, "DIR", dir)
+			if stdout.String() != expected {
+				t.Errorf("Expected '%v' but found '%v'", expected, stdout.String())
+			}
+			for i, name := range names {
+				content, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != tc.files[i] {
+					t.Errorf("Expected '%v' but found '%v'", tc.files[i], string(content))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/kdehairy/hclpath/v2"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// match is a node found in a file, along with the source of that file.
+type match struct {
+	file string
+	node hclpath.Node
+	src  []byte
+}
+
+// printer writes matches out in one of the output formats. flush is called
+// once every match has been printed.
+type printer interface {
+	print(m match) error
+	flush() error
+}
+
+func newPrinter(w io.Writer, output string, format string, count bool) (printer, error) {
+	if count {
+		return &countPrinter{w: w}, nil
+	}
+	if format != "" {
+		return newTemplatePrinter(w, format)
+	}
+	switch output {
+	case "text":
+		return &textPrinter{w: w}, nil
+	case "loc":
+		return &locPrinter{w: w}, nil
+	case "hcl":
+		return &hclPrinter{w: w}, nil
+	case "json":
+		return &jsonPrinter{w: w, matches: []jsonMatch{}}, nil
+	}
+	return nil, fmt.Errorf("unknown output format '%v'", output)
+}
+
+// textPrinter prints a match as `file:line: type "label"...`.
+type textPrinter struct {
+	w io.Writer
+}
+
+func (p *textPrinter) print(m match) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v:%v: %v", m.file, m.node.DefRange().Start.Line, m.node.Type())
+	for _, l := range m.node.Labels() {
+		fmt.Fprintf(&sb, " %q", l)
+	}
+	_, err := fmt.Fprintln(p.w, sb.String())
+	return err
+}
+
+func (p *textPrinter) flush() error {
+	return nil
+}
+
+// locPrinter prints a match as `file:line:col`.
+type locPrinter struct {
+	w io.Writer
+}
+
+func (p *locPrinter) print(m match) error {
+	pos := m.node.DefRange().Start
+	_, err := fmt.Fprintf(p.w, "%v:%v:%v\n", m.file, pos.Line, pos.Column)
+	return err
+}
+
+func (p *locPrinter) flush() error {
+	return nil
+}
+
+// hclPrinter prints the source of every match, followed by a blank line. Only
+// the source of native syntax can be printed.
+type hclPrinter struct {
+	w io.Writer
+}
+
+func (p *hclPrinter) print(m match) error {
+	switch m.node.(type) {
+	case *hclpath.SyntaxNode, *hclpath.AttrNode:
+	default:
+		return fmt.Errorf("cannot print the source of '%v' in '%v', which is not native syntax", m.node.Type(), m.file)
+	}
+	_, err := fmt.Fprintf(p.w, "%s\n\n", snippet(m))
+	return err
+}
+
+func (p *hclPrinter) flush() error {
+	return nil
+}
+
+// countPrinter only prints the number of matches.
+type countPrinter struct {
+	w     io.Writer
+	count int
+}
+
+func (p *countPrinter) print(m match) error {
+	p.count++
+	return nil
+}
+
+func (p *countPrinter) flush() error {
+	_, err := fmt.Fprintln(p.w, p.count)
+	return err
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+type jsonRange struct {
+	Start jsonPos `json:"start"`
+	End   jsonPos `json:"end"`
+}
+
+type jsonMatch struct {
+	File   string    `json:"file"`
+	Type   string    `json:"type"`
+	Labels []string  `json:"labels"`
+	Range  jsonRange `json:"range"`
+	// Attributes holds the values of the attributes that evaluate without a
+	// context, and Expressions the source of the others.
+	Attributes  map[string]ctyjson.SimpleJSONValue `json:"attributes"`
+	Expressions map[string]string                  `json:"expressions,omitempty"`
+}
+
+// jsonPrinter prints every match in a single JSON array.
+type jsonPrinter struct {
+	w       io.Writer
+	matches []jsonMatch
+}
+
+func (p *jsonPrinter) print(m match) error {
+	rng := sourceRange(m.node)
+	jm := jsonMatch{
+		File:   m.file,
+		Type:   m.node.Type(),
+		Labels: append([]string{}, m.node.Labels()...),
+		Range: jsonRange{
+			Start: jsonPos{Line: rng.Start.Line, Column: rng.Start.Column, Byte: rng.Start.Byte},
+			End:   jsonPos{Line: rng.End.Line, Column: rng.End.Column, Byte: rng.End.Byte},
+		},
+		Attributes: map[string]ctyjson.SimpleJSONValue{},
+	}
+	attrs, _ := m.node.Attributes()
+	if a, ok := m.node.(*hclpath.AttrNode); ok {
+		attrs = hcl.Attributes{a.Attribute().Name: a.Attribute()}
+	}
+	for name, a := range attrs {
+		val, diags := a.Expr.Value(nil)
+		if diags.HasErrors() || !val.IsWhollyKnown() {
+			if jm.Expressions == nil {
+				jm.Expressions = map[string]string{}
+			}
+			jm.Expressions[name] = string(a.Expr.Range().SliceBytes(m.src))
+			continue
+		}
+		jm.Attributes[name] = ctyjson.SimpleJSONValue{Value: val}
+	}
+	p.matches = append(p.matches, jm)
+	return nil
+}
+
+func (p *jsonPrinter) flush() error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(p.matches)
+}
+
+// templateData is what templates given with -format are executed on.
+type templateData struct {
+	File   string
+	Type   string
+	Labels []string
+	Range  hcl.Range
+}
+
+// templatePrinter prints every match through a template, followed by a new
+// line. Besides the fields of templateData, templates may call:
+//   - attr NAME: the value of an attribute, or its source when it does not
+//     evaluate without a context, and an empty string when it is missing,
+//   - expr NAME: the source of the expression of an attribute,
+//   - file: the name of the file,
+//   - srcRange: the range of the whole match in its file.
+type templatePrinter struct {
+	w    io.Writer
+	tmpl *template.Template
+	cur  match
+}
+
+func newTemplatePrinter(w io.Writer, format string) (*templatePrinter, error) {
+	p := &templatePrinter{w: w}
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"attr": p.attr,
+		"expr": p.expr,
+		"file": func() string {
+			return p.cur.file
+		},
+		"srcRange": func() hcl.Range {
+			return sourceRange(p.cur.node)
+		},
+	}).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %v", err)
+	}
+	p.tmpl = tmpl
+	return p, nil
+}
+
+func (p *templatePrinter) print(m match) error {
+	p.cur = m
+	data := templateData{
+		File:   m.file,
+		Type:   m.node.Type(),
+		Labels: m.node.Labels(),
+		Range:  sourceRange(m.node),
+	}
+	// a template failing halfway leaves nothing of the match printed.
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := p.w.Write(buf.Bytes())
+	return err
+}
+
+func (p *templatePrinter) flush() error {
+	return nil
+}
+
+func (p *templatePrinter) attribute(name string) *hcl.Attribute {
+	if a, ok := p.cur.node.(*hclpath.AttrNode); ok {
+		if a.Attribute().Name == name {
+			return a.Attribute()
+		}
+		return nil
+	}
+	attrs, _ := p.cur.node.Attributes()
+	return attrs[name]
+}
+
+func (p *templatePrinter) attr(name string) (string, error) {
+	a := p.attribute(name)
+	if a == nil {
+		return "", nil
+	}
+	val, diags := a.Expr.Value(nil)
+	if diags.HasErrors() || !val.IsWhollyKnown() {
+		return string(a.Expr.Range().SliceBytes(p.cur.src)), nil
+	}
+	switch {
+	case val.IsNull():
+		return "", nil
+	case val.Type() == cty.String:
+		return val.AsString(), nil
+	case val.Type() == cty.Number:
+		return val.AsBigFloat().Text('f', -1), nil
+	case val.Type() == cty.Bool:
+		return fmt.Sprint(val.True()), nil
+	}
+	text, err := ctyjson.SimpleJSONValue{Value: val}.MarshalJSON()
+	return string(text), err
+}
+
+func (p *templatePrinter) expr(name string) string {
+	a := p.attribute(name)
+	if a == nil {
+		return ""
+	}
+	return string(a.Expr.Range().SliceBytes(p.cur.src))
+}
+
+// sourceRange returns the range of the whole of a node, where DefRange only
+// covers the header of a block. JSON blocks only have their header range.
+func sourceRange(n hclpath.Node) hcl.Range {
+	switch n := n.(type) {
+	case *hclpath.SyntaxNode:
+		if n.Block() != nil {
+			return n.Block().Range()
+		}
+		return n.Body().(*hclsyntax.Body).SrcRange
+	case *hclpath.AttrNode:
+		return n.Attribute().Range
+	}
+	return n.DefRange()
+}
+
+// snippet returns the source of a match, indented as it is in its file.
+func snippet(m match) []byte {
+	rng := sourceRange(m.node)
+	start := bytes.LastIndexByte(m.src[:rng.Start.Byte], '\n') + 1
+	indent := m.src[start:rng.Start.Byte]
+	if len(bytes.TrimSpace(indent)) != 0 {
+		indent = nil
+	}
+	return append(append([]byte{}, indent...), rng.SliceBytes(m.src)...)
+}
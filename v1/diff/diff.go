@@ -0,0 +1,246 @@
+// Package diff renders the differences between two texts as a unified diff,
+// and carries them over to other texts.
+package diff
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around every change.
+const context = 3
+
+type op int
+
+const (
+	equal op = iota
+	del
+	ins
+)
+
+type edit struct {
+	op   op
+	line string
+}
+
+// Unified returns the unified diff turning a into b, under the file names
+// oldName and newName, or an empty string when they are equal.
+func Unified(oldName, newName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	edits := script(split(a), split(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %v\n+++ %v\n", oldName, newName)
+	for _, h := range hunks(edits) {
+		h.write(&sb)
+	}
+	return sb.String()
+}
+
+// Patch applies the changes turning a into b to base, a text with the same
+// lines as a up to their content, such as a before it was formatted. The lines
+// a and b have in common are taken from base, and the others from b. When base
+// and a do not have the same number of lines, b is returned.
+func Patch(base, a, b []byte) []byte {
+	baseLines, aLines := lines(base), lines(a)
+	if len(baseLines) != len(aLines) {
+		return b
+	}
+	var out []byte
+	i := 0
+	for _, e := range script(aLines, lines(b)) {
+		switch e.op {
+		case equal:
+			out = append(out, baseLines[i]...)
+			i++
+		case del:
+			i++
+		case ins:
+			out = append(out, e.line...)
+		}
+	}
+	return out
+}
+
+// lines cuts text into lines, each keeping its new line.
+func lines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	found := strings.SplitAfter(string(text), "\n")
+	if found[len(found)-1] == "" {
+		return found[:len(found)-1]
+	}
+	return found
+}
+
+// split cuts text into lines, each keeping its new line. A last line without
+// one is marked as such, the way diff does.
+func split(text []byte) []string {
+	found := lines(text)
+	if len(found) > 0 && !strings.HasSuffix(found[len(found)-1], "\n") {
+		found[len(found)-1] += "\n\\ No newline at end of file\n"
+	}
+	return found
+}
+
+// script finds a shortest edit script turning a into b, with the algorithm of
+// Eugene W. Myers.
+func script(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{op: equal, line: a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, edit{op: ins, line: b[y-1]})
+			y--
+		} else {
+			edits = append(edits, edit{op: del, line: a[x-1]})
+			x--
+		}
+	}
+	slices.Reverse(edits)
+	return edits
+}
+
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	edits              []edit
+}
+
+// hunks groups edits into hunks, merging changes closer than twice the
+// context apart.
+func hunks(edits []edit) []hunk {
+	var found []hunk
+	var cur *hunk
+	oldLine, newLine := 1, 1
+	for i, e := range edits {
+		if e.op != equal {
+			if cur == nil {
+				start := max(0, i-context)
+				back := i - start
+				found = append(found, hunk{oldStart: oldLine - back, newStart: newLine - back})
+				cur = &found[len(found)-1]
+				for _, c := range edits[start:i] {
+					cur.add(c)
+				}
+			}
+			cur.add(e)
+		} else if cur != nil {
+			if nextChange(edits, i) <= 2*context {
+				cur.add(e)
+			} else {
+				// close the hunk with the trailing context.
+				for _, c := range edits[i:min(len(edits), i+context)] {
+					cur.add(c)
+				}
+				cur = nil
+			}
+		}
+		switch e.op {
+		case equal:
+			oldLine++
+			newLine++
+		case del:
+			oldLine++
+		case ins:
+			newLine++
+		}
+	}
+	return found
+}
+
+// nextChange returns the number of unchanged edits from i to the next change,
+// or math.MaxInt when there is none.
+func nextChange(edits []edit, i int) int {
+	for j := i; j < len(edits); j++ {
+		if edits[j].op != equal {
+			return j - i
+		}
+	}
+	return math.MaxInt
+}
+
+func (h *hunk) add(e edit) {
+	h.edits = append(h.edits, e)
+	if e.op != ins {
+		h.oldLines++
+	}
+	if e.op != del {
+		h.newLines++
+	}
+}
+
+func (h *hunk) write(sb *strings.Builder) {
+	fmt.Fprintf(sb, "@@ -%v +%v @@\n", span(h.oldStart, h.oldLines), span(h.newStart, h.newLines))
+	for _, e := range h.edits {
+		switch e.op {
+		case equal:
+			sb.WriteString(" ")
+		case del:
+			sb.WriteString("-")
+		case ins:
+			sb.WriteString("+")
+		}
+		sb.WriteString(e.line)
+	}
+}
+
+// span renders a range of lines. An empty range starts at the line before it.
+func span(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%v,%v", start, lines)
+}
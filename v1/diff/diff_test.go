@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nx\nc\n",
+			expected: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++x
+ c
+`,
+		},
+		{
+			name: "context is limited",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nx\n6\n7\n8\n9\n",
+			expected: `--- a/f
++++ b/f
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++x
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name: "distant changes",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:    "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			expected: `--- a/f
++++ b/f
+@@ -1,4 +1,4 @@
+-1
++x
+ 2
+ 3
+ 4
+@@ -7,4 +7,4 @@
+ 7
+ 8
+ 9
+-10
++y
+`,
+		},
+		{
+			name: "added to an empty file",
+			a:    "",
+			b:    "a\n",
+			expected: `--- a/f
++++ b/f
+@@ -0,0 +1 @@
++a
+`,
+		},
+		{
+			name: "missing new line",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			expected: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			found := Unified("a/f", "b/f", []byte(tc.a), []byte(tc.b))
+			if found != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, found)
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "unchanged lines come from base",
+			base:     "a  =  1\nb=2\nc =3\n",
+			a:        "a = 1\nb = 2\nc = 3\n",
+			b:        "a = 1\nb = 5\nc = 3\n",
+			expected: "a  =  1\nb = 5\nc =3\n",
+		},
+		{
+			name:     "inserted and removed lines",
+			base:     "x {\n    a=1\n    b=2\n}\n",
+			a:        "x {\n  a = 1\n  b = 2\n}\n",
+			b:        "x {\n  b = 2\n  c = 3\n}\n",
+			expected: "x {\n    b=2\n  c = 3\n}\n",
+		},
+		{
+			name:     "missing new line",
+			base:     "a=1",
+			a:        "a = 1",
+			b:        "a = 1\nb = 2\n",
+			expected: "a = 1\nb = 2\n",
+		},
+		{
+			name:     "base with other lines",
+			base:     "a=1\n",
+			a:        "a = 1\n\n",
+			b:        "a = 2\n",
+			expected: "a = 2\n",
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			found := string(Patch([]byte(tc.base), []byte(tc.a), []byte(tc.b)))
+			if found != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, found)
+			}
+		})
+	}
+}
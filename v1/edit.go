@@ -0,0 +1,558 @@
+package hclpath
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kdehairy/hclpath/v2/diff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// target is a match of a query in an hclwrite file: a block, the root body or
+// an attribute.
+type target struct {
+	node Node
+	// parent is the body holding the block or the attribute, nil for the
+	// root body.
+	parent *hclwrite.Body
+	// block is nil for the root body and for attributes.
+	block *hclwrite.Block
+	// body is the body of the block, or the root body. It is nil for
+	// attributes.
+	body *hclwrite.Body
+	// attr is the name of a matched attribute.
+	attr string
+}
+
+// writeIndex relates the nodes of the hclsyntax parse of a file to their
+// counterparts in its hclwrite tree. Attributes are keyed on the byte their
+// range starts at, as hclsyntax builds a new hcl.Attribute on every read.
+type writeIndex struct {
+	blocks map[*hclsyntax.Block]target
+	attrs  map[int]target
+}
+
+func (idx *writeIndex) add(sbody *hclsyntax.Body, wbody *hclwrite.Body) error {
+	wblocks := wbody.Blocks()
+	if len(wblocks) != len(sbody.Blocks) {
+		return errors.New("the file does not match its own source")
+	}
+	for name, a := range sbody.Attributes {
+		idx.attrs[a.SrcRange.Start.Byte] = target{parent: wbody, attr: name}
+	}
+	for i, sb := range sbody.Blocks {
+		wb := wblocks[i]
+		idx.blocks[sb] = target{parent: wbody, block: wb, body: wb.Body()}
+		if err := idx.add(sb.Body, wb.Body()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targets evaluates query against the native syntax parse of file and relates
+// every match to the hclwrite tree. Matches are all resolved before anything
+// is edited, so that edits do not affect what the query matches.
+func targets(file *hclwrite.File, query string, opts []Option) ([]target, error) {
+	compilation, err := Compile(query, opts...)
+	if err != nil {
+		return nil, err
+	}
+	src, diags := hclsyntax.ParseConfig(Bytes(file), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file: %v", diags)
+	}
+	body, ok := src.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, errors.New("failed to parse file: not a native syntax body")
+	}
+	idx := &writeIndex{blocks: map[*hclsyntax.Block]target{}, attrs: map[int]target{}}
+	if err := idx.add(body, file.Body()); err != nil {
+		return nil, err
+	}
+
+	nodes, err := compilation.Exec(Nodes{NewSyntaxNode(body)})
+	if err != nil {
+		return nil, err
+	}
+	found := make([]target, 0, len(nodes))
+	for _, n := range nodes {
+		var t target
+		switch n := n.(type) {
+		case *SyntaxNode:
+			if n.Block() == nil {
+				t = target{body: file.Body()}
+			} else {
+				t, ok = idx.blocks[n.Block()]
+			}
+		case *AttrNode:
+			t, ok = idx.attrs[n.Attribute().Range.Start.Byte]
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("failed to locate '%v' in the file", n.Type())
+		}
+		t.node = n
+		found = append(found, t)
+	}
+	return found, nil
+}
+
+// Bytes returns the content of file as it is. Unlike file.Bytes(), which
+// formats the whole file, and does so in place, it leaves what the edits of
+// this package did not touch as it was in the source of file.
+func Bytes(file *hclwrite.File) []byte {
+	return file.BuildTokens(nil).Bytes()
+}
+
+// keepFormat runs edit on files, then restores the lines edit did not change
+// to what they were. hclwrite can only write edited files out formatted, so
+// the edited lines come out formatted, along with the neighbouring ones they
+// realign. When edit or the result fails, every file is restored as it was.
+func keepFormat(files []*hclwrite.File, edit func() error) error {
+	before := make([][]byte, len(files))
+	for i, f := range files {
+		before[i] = Bytes(f)
+	}
+	restore := func() {
+		for i, f := range files {
+			if original, diags := hclwrite.ParseConfig(before[i], "", hcl.InitialPos); !diags.HasErrors() {
+				*f = *original
+			}
+		}
+	}
+	if err := edit(); err != nil {
+		restore()
+		return err
+	}
+	edited := make([]*hclwrite.File, len(files))
+	for i, f := range files {
+		src := diff.Patch(before[i], hclwrite.Format(before[i]), f.Bytes())
+		e, diags := hclwrite.ParseConfig(src, "", hcl.InitialPos)
+		if diags.HasErrors() {
+			restore()
+			return fmt.Errorf("invalid result: %v", diags)
+		}
+		edited[i] = e
+	}
+	for i, f := range files {
+		*f = *edited[i]
+	}
+	return nil
+}
+
+// Set sets the attribute attr to value in every block matched by query, or
+// in the root body when the query is '.', and returns the number of blocks
+// updated. attr may also be a path into nested object constructors, such as
+// `aws.version` in a required_providers block, in which case the attribute
+// must exist and the last key is added when missing. Existing attributes keep
+// their position and comments; new ones are appended to the block. Only the
+// edited lines, and the ones they realign, are formatted: write the file out
+// with Bytes to leave the rest as it was. Nothing is edited when an error is
+// returned.
+func Set(file *hclwrite.File, query string, attr string, value cty.Value, opts ...Option) (int, error) {
+	return set(file, query, attr, hclwrite.TokensForValue(value), opts)
+}
+
+// SetExpr is like Set, but takes the new value as the text of an HCL
+// expression, such as `var.region` or `">= 5.20"`, written as is.
+func SetExpr(file *hclwrite.File, query string, attr string, expr string, opts ...Option) (int, error) {
+	tokens, err := exprTokens(expr)
+	if err != nil {
+		return 0, err
+	}
+	return set(file, query, attr, tokens, opts)
+}
+
+func set(file *hclwrite.File, query string, attr string, tokens hclwrite.Tokens, opts []Option) (count int, err error) {
+	err = keepFormat([]*hclwrite.File{file}, func() error {
+		count, err = setTokens(file, query, attr, tokens, opts)
+		return err
+	})
+	return count, err
+}
+
+func setTokens(file *hclwrite.File, query string, attr string, tokens hclwrite.Tokens, opts []Option) (int, error) {
+	path := strings.Split(attr, ".")
+	for _, name := range path {
+		if !hclsyntax.ValidIdentifier(name) {
+			return 0, fmt.Errorf("invalid attribute name '%v'", attr)
+		}
+	}
+	found, err := targets(file, query, opts)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range found {
+		if t.body == nil {
+			return 0, fmt.Errorf("cannot set an attribute inside attribute '%v'", t.attr)
+		}
+	}
+	if len(path) == 1 {
+		for _, t := range found {
+			t.body.SetAttributeRaw(attr, tokens)
+		}
+		return len(found), nil
+	}
+
+	source := Bytes(file)
+	text := strings.TrimSpace(string(tokens.Bytes()))
+	splices := make([]splice, 0, len(found))
+	for _, t := range found {
+		body := t.node.Body().(*hclsyntax.Body)
+		a, ok := body.Attributes[path[0]]
+		if !ok {
+			return 0, fmt.Errorf("attribute '%v' not found in '%v'", path[0], t.node.Type())
+		}
+		s, err := spliceKey(source, a.Expr, path, text)
+		if err != nil {
+			return 0, err
+		}
+		splices = append(splices, s)
+	}
+	if err := applySplices(file, source, splices); err != nil {
+		return 0, err
+	}
+	return len(found), nil
+}
+
+// spliceKey tells how to set the key path[1:] of the object constructor expr
+// to text. Only the last key is added when missing.
+func spliceKey(src []byte, expr hclsyntax.Expression, path []string, text string) (splice, error) {
+	for i, key := range path[1:] {
+		obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			return splice{}, fmt.Errorf("'%v' is not an object", strings.Join(path[:i+1], "."))
+		}
+		var value hclsyntax.Expression
+		for _, item := range obj.Items {
+			if hcl.ExprAsKeyword(item.KeyExpr) == key {
+				value = item.ValueExpr
+			} else if v, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && v.Type() == cty.String && v.IsKnown() && !v.IsNull() && v.AsString() == key {
+				value = item.ValueExpr
+			}
+		}
+		if value != nil {
+			expr = value
+			continue
+		}
+		if i+2 < len(path) {
+			return splice{}, fmt.Errorf("key '%v' not found", strings.Join(path[:i+2], "."))
+		}
+		return spliceClosing(src, obj.SrcRange.End.Byte-1, key+" = "+text), nil
+	}
+	rng := expr.Range()
+	return splice{offset: rng.Start.Byte, size: rng.End.Byte - rng.Start.Byte, text: text}, nil
+}
+
+// exprTokens checks that expr is a valid HCL expression and returns its
+// tokens.
+func exprTokens(expr string) (hclwrite.Tokens, error) {
+	if _, diags := hclsyntax.ParseExpression([]byte(expr), "", hcl.InitialPos); diags.HasErrors() {
+		return nil, fmt.Errorf("invalid expression '%v': %v", expr, diags)
+	}
+	f, diags := hclwrite.ParseConfig([]byte("x = "+expr+"\n"), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid expression '%v': %v", expr, diags)
+	}
+	return f.Body().GetAttribute("x").Expr().BuildTokens(nil), nil
+}
+
+// Remove deletes every block matched by query, or every attribute when the
+// query ends in a projection such as `provider:aws/@alias`, and returns what
+// was removed, as matched before the edit. Comments leading a removed block or
+// attribute go along with it, while the blank lines around it are left as
+// they are. Nothing is edited when an error is returned.
+func Remove(file *hclwrite.File, query string, opts ...Option) (removed Nodes, err error) {
+	err = keepFormat([]*hclwrite.File{file}, func() error {
+		removed, err = remove(file, query, opts)
+		return err
+	})
+	return removed, err
+}
+
+func remove(file *hclwrite.File, query string, opts []Option) (Nodes, error) {
+	found, err := targets(file, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range found {
+		if t.parent == nil {
+			return nil, errors.New("cannot remove the root body")
+		}
+	}
+	removed := make(Nodes, 0, len(found))
+	for _, t := range found {
+		if t.block != nil {
+			t.parent.RemoveBlock(t.block)
+		} else {
+			t.parent.RemoveAttribute(t.attr)
+		}
+		removed = append(removed, t.node)
+	}
+	return removed, nil
+}
+
+// Position tells where Insert places new content relative to a match.
+type Position int
+
+const (
+	// Inside appends the content to the body of each matched block, or to
+	// the root body.
+	Inside Position = iota
+	// Before places the content just before each matched block or
+	// attribute, ahead of the comments leading it.
+	Before
+	// After places the content just after each matched block or attribute.
+	After
+)
+
+// IfMissing makes Insert skip the matches where the body taking the content
+// already has a block of a type, or an attribute of a name, defined by the
+// content. This is the body of the match for Inside, and the one holding it
+// for Before and After.
+func IfMissing() Option {
+	return func(c *config) {
+		c.ifMissing = true
+	}
+}
+
+// Insert adds src, the HCL text of one or more attributes and blocks, at pos
+// relative to every block or attribute matched by query, and returns the
+// number of matches the content was added to. The file is parsed again after
+// the insertion, so blocks and bodies taken from it beforehand no longer
+// belong to it. Nothing is
+// edited when an error is returned, such as when an attribute would be
+// defined twice, or when content would go before or after a match sharing its
+// line with other content, as in a single line block.
+func Insert(file *hclwrite.File, query string, pos Position, src string, opts ...Option) (count int, err error) {
+	err = keepFormat([]*hclwrite.File{file}, func() error {
+		count, err = insert(file, query, pos, src, opts)
+		return err
+	})
+	return count, err
+}
+
+func insert(file *hclwrite.File, query string, pos Position, src string, opts []Option) (int, error) {
+	snippet, diags := hclwrite.ParseConfig([]byte(src), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return 0, fmt.Errorf("invalid content: %v", diags)
+	}
+	text := strings.TrimSpace(string(snippet.Bytes()))
+
+	found, err := targets(file, query, opts)
+	if err != nil {
+		return 0, err
+	}
+	cfg := newConfig(opts)
+	source := Bytes(file)
+	splices := make([]splice, 0, len(found))
+	for _, t := range found {
+		body := t.body
+		if pos != Inside {
+			body = t.parent
+		}
+		if cfg.ifMissing && body != nil && defines(body, snippet.Body()) {
+			continue
+		}
+		s, err := spliceAt(source, t, pos, text)
+		if err != nil {
+			return 0, err
+		}
+		splices = append(splices, s)
+	}
+	if err := applySplices(file, source, splices); err != nil {
+		return 0, err
+	}
+	return len(splices), nil
+}
+
+// defines tells whether body has a block of a type, or an attribute of a
+// name, found in content.
+func defines(body, content *hclwrite.Body) bool {
+	for name := range content.Attributes() {
+		if body.GetAttribute(name) != nil {
+			return true
+		}
+	}
+	for _, block := range content.Blocks() {
+		if slices.ContainsFunc(body.Blocks(), func(b *hclwrite.Block) bool {
+			return b.Type() == block.Type()
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertBlock is like Insert, but takes the content as a block, such as one
+// built with hclwrite.NewBlock.
+func InsertBlock(file *hclwrite.File, query string, pos Position, block *hclwrite.Block, opts ...Option) (int, error) {
+	f := hclwrite.NewEmptyFile()
+	f.Body().AppendBlock(block)
+	return Insert(file, query, pos, string(f.Bytes()), opts...)
+}
+
+// splice replaces the size bytes at offset with text.
+type splice struct {
+	offset int
+	size   int
+	text   string
+}
+
+// applySplices applies splices, which must not overlap, to source and parses
+// the result back into file.
+func applySplices(file *hclwrite.File, source []byte, splices []splice) error {
+	// later offsets are spliced first, keeping earlier ones valid.
+	slices.SortStableFunc(splices, func(a, b splice) int {
+		return b.offset - a.offset
+	})
+	for _, s := range splices {
+		source = slices.Concat(source[:s.offset], []byte(s.text), source[s.offset+s.size:])
+	}
+
+	if _, diags := hclsyntax.ParseConfig(source, "", hcl.InitialPos); diags.HasErrors() {
+		return fmt.Errorf("invalid result: %v", diags)
+	}
+	edited, diags := hclwrite.ParseConfig(source, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("invalid result: %v", diags)
+	}
+	*file = *edited
+	return nil
+}
+
+// spliceAt tells where text goes in src for t. Blocks placed next to a block
+// are separated from it by a blank line.
+func spliceAt(src []byte, t target, pos Position, text string) (splice, error) {
+	var rng hcl.Range
+	var block *hclsyntax.Block
+	switch n := t.node.(type) {
+	case *SyntaxNode:
+		block = n.Block()
+		if block != nil {
+			rng = block.Range()
+		}
+	case *AttrNode:
+		rng = n.Attribute().Range
+	}
+
+	if pos == Before || pos == After {
+		if t.parent == nil {
+			return splice{}, errors.New("cannot insert next to the root body")
+		}
+		if !ownsLine(src, rng) {
+			return splice{}, fmt.Errorf("cannot insert next to '%v', which shares its line with other content", t.node.Type())
+		}
+	}
+
+	switch pos {
+	case Inside:
+		if t.body == nil {
+			return splice{}, fmt.Errorf("cannot insert inside attribute '%v'", t.attr)
+		}
+		if block == nil {
+			return splice{offset: len(src), text: "\n" + text + "\n"}, nil
+		}
+		return spliceClosing(src, block.CloseBraceRange.Start.Byte, text), nil
+	case Before:
+		sep := "\n"
+		if block != nil {
+			sep = "\n\n"
+		}
+		return splice{offset: leadStart(src, lineStart(src, rng.Start.Byte)), text: text + sep}, nil
+	case After:
+		sep := ""
+		if block != nil {
+			sep = "\n"
+		}
+		end := lineEnd(src, rng.End.Byte)
+		return splice{offset: end, text: sep + text + "\n"}, nil
+	}
+	return splice{}, fmt.Errorf("unknown position '%v'", pos)
+}
+
+// spliceClosing tells how to add a line holding text right before the closing
+// brace at offset brace.
+func spliceClosing(src []byte, brace int, text string) splice {
+	start := lineStart(src, brace)
+	if len(bytes.TrimSpace(src[start:brace])) == 0 {
+		return splice{offset: start, text: text + "\n"}
+	}
+	return splice{offset: brace, text: "\n" + text + "\n"}
+}
+
+// ownsLine reports whether nothing but white space and a comment shares the
+// lines of rng, as when a block or an attribute is inside a single line block.
+func ownsLine(src []byte, rng hcl.Range) bool {
+	before := src[lineStart(src, rng.Start.Byte):rng.Start.Byte]
+	after := bytes.TrimSpace(src[rng.End.Byte:lineEnd(src, rng.End.Byte)])
+	return len(bytes.TrimSpace(before)) == 0 &&
+		(len(after) == 0 || bytes.HasPrefix(after, []byte("#")) || bytes.HasPrefix(after, []byte("//")))
+}
+
+// lineStart returns the offset of the start of the line holding offset.
+func lineStart(src []byte, offset int) int {
+	return bytes.LastIndexByte(src[:offset], '\n') + 1
+}
+
+// lineEnd returns the offset just past the end of the line holding offset,
+// new line included.
+func lineEnd(src []byte, offset int) int {
+	i := bytes.IndexByte(src[offset:], '\n')
+	if i < 0 {
+		return len(src)
+	}
+	return offset + i + 1
+}
+
+// leadStart moves start, the start of a line, up over the comment lines right
+// above it.
+func leadStart(src []byte, start int) int {
+	for start > 0 {
+		prev := lineStart(src, start-1)
+		line := bytes.TrimSpace(src[prev:start])
+		if !bytes.HasPrefix(line, []byte("#")) && !bytes.HasPrefix(line, []byte("//")) {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// FileDiff is the change an edit would make to a file, as a unified diff.
+type FileDiff struct {
+	Name string
+	Diff string
+}
+
+// DryRun applies edit, such as a call to Set, Remove or Insert, to a copy of
+// every file of files, keyed on their names, and returns the diffs of the
+// files it would change, in name order. The files themselves are left
+// untouched. Diffs are taken against the current content of each file, as
+// returned by Bytes.
+func DryRun(files map[string]*hclwrite.File, edit func(*hclwrite.File) error) ([]FileDiff, error) {
+	diffs := []FileDiff{}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		before := Bytes(files[name])
+		copied, diags := hclwrite.ParseConfig(before, name, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse file '%v': %v", name, diags)
+		}
+		if err := edit(copied); err != nil {
+			return nil, fmt.Errorf("failed to edit file '%v': %v", name, err)
+		}
+		if d := diff.Unified("a/"+name, "b/"+name, before, Bytes(copied)); d != "" {
+			diffs = append(diffs, FileDiff{Name: name, Diff: d})
+		}
+	}
+	return diffs, nil
+}
@@ -1,57 +1,239 @@
 package hclpath
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"strings"
 
-	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2"
 	"github.com/kdehairy/hclpath/v2/cmpval"
 	"github.com/kdehairy/hclpath/v2/parse"
 )
 
-type (
-	execFunc func(hclsyntax.Blocks) (hclsyntax.Blocks, error)
-	evalFunc func(hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error)
-)
+// item is a node flowing through the evaluation, along with its depth below
+// the nodes the compilation was executed against.
+type item struct {
+	node  Node
+	depth int
+}
+
+// stream is a lazily evaluated sequence of nodes. A non-nil error ends the
+// sequence.
+type stream = iter.Seq2[item, error]
 
+type evalFunc func(*run, stream) stream
+
+// Compilation is a compiled query. It holds no mutable state: every execution
+// keeps its own, so a single Compilation may be executed from any number of
+// goroutines at once.
 type Compilation struct {
-	Exec execFunc
+	cfg  *config
+	eval *evaluation
 }
 
 type evaluation struct {
-	Do evalFunc
+	Do   evalFunc
+	expr parse.Expr
+	lhs  *evaluation
+	rhs  *evaluation
 }
 
-func Compile(path string) (*Compilation, error) {
-	logger.Info("Recieved path", "path", path)
+// Compile parses path into a Compilation that can be executed any number of
+// times.
+func Compile(path string, opts ...Option) (*Compilation, error) {
+	cfg := newConfig(opts)
+	cfg.logger.Info("Recieved path", "path", path)
 	p := parse.NewParser(strings.NewReader(path))
 	expr, err := p.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("syntax error: %v", err)
+		return nil, err
 	}
-	logger.Debug("AST", "expr", expr.Print())
+	return compileExpr(cfg, expr)
+}
 
-	eval, _, err := evaluate(expr)
-	if err != nil {
+// CompileExpr compiles an AST, such as one built or rewritten with the parse
+// package, without going through query text.
+func CompileExpr(expr parse.Expr, opts ...Option) (*Compilation, error) {
+	return compileExpr(newConfig(opts), expr)
+}
+
+func compileExpr(cfg *config, expr parse.Expr) (*Compilation, error) {
+	if err := validate(expr); err != nil {
 		return nil, err
 	}
+	cfg.logger.Debug("AST", "expr", expr.Print())
 
-	Compilation := &Compilation{
-		Exec: func(b hclsyntax.Blocks) (blocks hclsyntax.Blocks, err error) {
-			logger.Debug("Executing Compilation...")
-			blocks, _, err = eval.Do(b)
-			return
-		},
+	eval, _, err := evaluate(cfg, expr)
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Debug("Compilation Complete", "Compilation", Compilation)
+	Compilation := &Compilation{cfg: cfg, eval: eval}
+
+	cfg.logger.Debug("Compilation Complete", "Compilation", Compilation)
 
 	return Compilation, nil
 }
 
-func evaluate(expr parse.Expr) (*evaluation, interface{}, error) {
-	logger.Debug(">> Evaluating Expr:", "AST", expr.Print(), "type", expr.GetType())
+// validate checks that an AST, which may have been built by hand, has the
+// shape evaluate expects.
+func validate(expr parse.Expr) error {
+	if expr == nil {
+		return errors.New("expected an expression, but found none")
+	}
+	var err error
+	parse.Inspect(expr, func(e parse.Expr) bool {
+		if e == nil || err != nil {
+			return false
+		}
+		if e.GetOp() == nil {
+			switch e.GetType() {
+			case parse.Type, parse.Label, parse.Attr, parse.Num, parse.Str, parse.Root:
+			default:
+				err = fmt.Errorf("unknown expression type '%v'", e.GetType())
+			}
+			return false
+		}
+		switch *e.GetOp() {
+		case parse.NstOp, parse.EntOp, parse.PrjOp, parse.FltOp, parse.LblOp, parse.EqlOp, parse.SelOp:
+		default:
+			err = fmt.Errorf("unknown operator '%v'", *e.GetOp())
+			return false
+		}
+		if e.GetLeft() == nil || e.GetRight() == nil {
+			err = fmt.Errorf("operator '%v' needs both sides", *e.GetOp())
+			return false
+		}
+		if *e.GetOp() == parse.PrjOp && e.GetRight().GetType() != parse.Attr {
+			err = fmt.Errorf("operator '%v' needs an attribute name", *e.GetOp())
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// Result holds the matches of an execution, along with the warnings
+// collected in lenient mode.
+type Result struct {
+	Nodes    Nodes
+	Warnings hcl.Diagnostics
+	// Trace is only recorded when the compilation is given WithTrace.
+	Trace *Trace
+	// Suggestions are only given when nothing matched.
+	Suggestions []Suggestion
+}
+
+// All lazily evaluates the compilation against the children of parents.
+// Blocks are only visited as the sequence is consumed, so stopping early
+// skips the rest of the traversal.
+func (c *Compilation) All(parents Nodes) iter.Seq2[Node, error] {
+	return c.AllContext(context.Background(), parents)
+}
+
+// AllContext is like All, but stops with the context error once ctx is done.
+func (c *Compilation) AllContext(ctx context.Context, parents Nodes) iter.Seq2[Node, error] {
+	return func(yield func(Node, error) bool) {
+		r, cancel := c.newRun(ctx)
+		defer cancel()
+		for b, err := range c.exec(r, parents) {
+			if !yield(b, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Exec evaluates the compilation against the children of parents and
+// collects every match.
+func (c *Compilation) Exec(parents Nodes) (Nodes, error) {
+	return c.ExecContext(context.Background(), parents)
+}
+
+// ExecContext is like Exec, but stops with the context error once ctx is
+// done.
+func (c *Compilation) ExecContext(ctx context.Context, parents Nodes) (Nodes, error) {
+	res, err := c.Run(ctx, parents)
+	if err != nil {
+		return nil, err
+	}
+	return res.Nodes, nil
+}
+
+// Run is like ExecContext, but also returns the warnings collected in lenient
+// mode.
+func (c *Compilation) Run(ctx context.Context, parents Nodes) (*Result, error) {
+	r, cancel := c.newRun(ctx)
+	defer cancel()
+	res := &Result{Nodes: Nodes{}}
+	for b, err := range c.exec(r, parents) {
+		if err != nil {
+			return nil, err
+		}
+		res.Nodes = append(res.Nodes, b)
+	}
+	res.Warnings = r.warnings
+	res.Trace = r.buildTrace(c.eval)
+	if len(res.Nodes) == 0 {
+		res.Suggestions = r.suggestions()
+	}
+	return res, nil
+}
+
+func (c *Compilation) newRun(ctx context.Context) (*run, context.CancelFunc) {
+	cancel := func() {}
+	if c.cfg.limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, c.cfg.limits.Timeout, &LimitError{
+			Limit: "timeout",
+			Err:   context.DeadlineExceeded,
+		})
+	}
+	r := &run{
+		ctx:        ctx,
+		limits:     c.cfg.limits,
+		mode:       c.cfg.mode,
+		candidates: map[*evaluation]*candidates{},
+	}
+	if c.cfg.trace {
+		r.traces = map[*evaluation]*Trace{}
+	}
+	return r, cancel
+}
+
+func (c *Compilation) exec(r *run, parents Nodes) iter.Seq2[Node, error] {
+	return func(yield func(Node, error) bool) {
+		c.cfg.logger.Debug("Executing Compilation...")
+		results := 0
+		for b, err := range c.eval.Do(r, fromNodes(parents)) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			results++
+			if r.limits.MaxResults > 0 && results > r.limits.MaxResults {
+				yield(nil, &LimitError{Limit: "results", Max: r.limits.MaxResults})
+				return
+			}
+			if !yield(b.node, nil) {
+				return
+			}
+		}
+	}
+}
+
+// First returns the first match, or nil when there is none. The traversal
+// stops as soon as a match is found.
+func (c *Compilation) First(parents Nodes) (Node, error) {
+	for b, err := range c.All(parents) {
+		return b, err
+	}
+	return nil, nil
+}
+
+func evaluate(cfg *config, expr parse.Expr) (*evaluation, interface{}, error) {
+	cfg.logger.Debug(">> Evaluating Expr:", "AST", expr.Print(), "type", expr.GetType())
 	var lhs *evaluation
 	var rhs *evaluation
 	var lvalue interface{}
@@ -59,244 +241,415 @@ func evaluate(expr parse.Expr) (*evaluation, interface{}, error) {
 	var value interface{}
 	var self *evaluation
 	var err error
-	logger.Debug(">> Start evaluating sides")
+	cfg.logger.Debug(">> Start evaluating sides")
 	if expr.GetLeft() != nil {
-		lhs, lvalue, err = evaluate(expr.GetLeft())
+		lhs, lvalue, err = evaluate(cfg, expr.GetLeft())
 		if err != nil {
 			return nil, nil, err
 		}
 	}
 
 	if expr.GetRight() != nil {
-		rhs, rvalue, err = evaluate(expr.GetRight())
+		rhs, rvalue, err = evaluate(cfg, expr.GetRight())
 		if err != nil {
 			return nil, nil, err
 		}
 	}
-	logger.Debug(">> End evaluating sides")
+	cfg.logger.Debug(">> End evaluating sides")
 
-	self = &evaluation{}
+	self = &evaluation{expr: expr, lhs: lhs, rhs: rhs}
 	if expr.GetOp() != nil {
-		logger.Debug("Expr operator", "Op", *expr.GetOp())
+		cfg.logger.Debug("Expr operator", "Op", *expr.GetOp())
 		switch *expr.GetOp() {
-		case parse.NstOp:
-			self.Do = func(b hclsyntax.Blocks) (blocks hclsyntax.Blocks, value interface{}, err error) {
-				blocks, _, err = lhs.Do(b)
-				if err != nil {
-					return nil, nil, err
-				}
-				if blocks == nil {
-					return nil, nil, errors.New("unexpected null blocks on left of operator")
-				}
-				candidates := hclsyntax.Blocks{}
-				for _, b := range blocks {
-					if res, _, e := rhs.Do(b.Body.Blocks); len(res) > 0 && e == nil {
-						candidates = append(candidates, res...)
-					} else if e != nil {
-						return nil, nil, e
-					}
-				}
-				return candidates, nil, nil
+		case parse.NstOp, parse.FltOp, parse.LblOp:
+			// the right hand side either selects the children of, or filters,
+			// whatever the left hand side yields.
+			self.Do = func(r *run, in stream) stream {
+				return rhs.Do(r, lhs.Do(r, in))
 			}
-		case parse.FltOp, parse.LblOp:
-			self.Do = func(b hclsyntax.Blocks) (blocks hclsyntax.Blocks, value interface{}, err error) {
-				blocks, _, err = lhs.Do(b)
-				if err != nil {
-					return nil, nil, err
-				}
-				if blocks == nil {
-					return nil, nil, errors.New("unexpected null blocks on left of operator")
+		case parse.PrjOp:
+			// the right hand side projects, rather than filters, the
+			// attributes of whatever the left hand side yields.
+			name, _ := rvalue.(string)
+			rhs.Do = traced(rhs, func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'attr' projection", "expr", expr.Print())
+				return findAttrs(cfg, r, rhs, in, name)
+			})
+			self.Do = func(r *run, in stream) stream {
+				return rhs.Do(r, lhs.Do(r, in))
+			}
+		case parse.EntOp:
+			self.Do = func(r *run, in stream) stream {
+				return func(yield func(item, error) bool) {
+					for b, err := range lhs.Do(r, in) {
+						if err != nil {
+							yield(item{}, err)
+							return
+						}
+						m, ok := b.node.(*ModuleNode)
+						if !ok {
+							yield(item{}, errors.New("module traversal is not enabled, use QueryModule"))
+							return
+						}
+						root, err := m.Enter()
+						if err != nil {
+							yield(item{}, err)
+							return
+						}
+						if root == nil {
+							continue
+						}
+						module := func(yield func(item, error) bool) {
+							yield(item{node: root, depth: b.depth}, nil)
+						}
+						for res, err := range rhs.Do(r, module) {
+							if !yield(res, err) || err != nil {
+								return
+							}
+						}
+					}
 				}
-				return rhs.Do(blocks)
 			}
 		case parse.EqlOp:
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				blocks, _, err := lhs.Do(b)
-				if err != nil {
-					return nil, nil, err
-				}
-				if lvalue == nil {
-					return nil, nil, errors.New("expected lvalue, but found none")
-				}
-				if rvalue == nil {
-					return nil, nil, errors.New("expected rvalue, but found none")
-				}
-
-				attrName, ok := lvalue.(string)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected string lvalue, but found '%v'", lvalue)
-				}
-				attrValue, ok := rvalue.(string)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected string rvalue, but found '%v'", rvalue)
-				}
-
-				return filter(blocks, attrName, attrValue)
+			if lvalue == nil {
+				return nil, nil, errors.New("expected lvalue, but found none")
+			}
+			if rvalue == nil {
+				return nil, nil, errors.New("expected rvalue, but found none")
+			}
+			attrName, ok := lvalue.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected string lvalue, but found '%v'", lvalue)
+			}
+			attrValue, ok := rvalue.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected string rvalue, but found '%v'", rvalue)
+			}
+			self.Do = func(r *run, in stream) stream {
+				return filter(cfg, r, self, lhs.Do(r, in), func(b Node) (bool, error) {
+					return hasAttrValue(cfg, b, attrName, attrValue)
+				})
 			}
 		case parse.SelOp:
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				blocks, _, err := lhs.Do(b)
-				if err != nil {
-					return nil, nil, err
-				}
-
-				if rvalue == nil {
-					return nil, nil, errors.New("expected rvalue, but found none")
-				}
-				index, ok := rvalue.(int)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected integer rvalue, but found '%v'", rvalue)
-				}
-
-				if len(blocks) <= index {
-					return nil, nil, fmt.Errorf("index '%v' out of bound, got a list of '%v' blocks", rvalue, len(blocks))
+			if rvalue == nil {
+				return nil, nil, errors.New("expected rvalue, but found none")
+			}
+			index, ok := rvalue.(int)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected integer rvalue, but found '%v'", rvalue)
+			}
+			self.Do = func(r *run, in stream) stream {
+				return func(yield func(item, error) bool) {
+					count := 0
+					var last Node
+					for b, err := range lhs.Do(r, in) {
+						if err != nil {
+							yield(item{}, err)
+							return
+						}
+						if count == index {
+							yield(b, nil)
+							return
+						}
+						r.drop(self, b.node)
+						last = b.node
+						count++
+					}
+					diag := &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Index out of bound",
+						Detail:   fmt.Sprintf("index '%v' out of bound, got a list of '%v' blocks", index, count),
+					}
+					if last != nil {
+						diag.Subject = last.DefRange().Ptr()
+					}
+					if err := r.anomaly(hcl.Diagnostics{diag}); err != nil {
+						yield(item{}, err)
+					}
 				}
-
-				return blocks[index : index+1], nil, nil
 			}
 		}
 	} else {
-		logger.Debug("No operator")
+		cfg.logger.Debug("No operator")
 		switch expr.GetType() {
 		case parse.Type:
 			value = expr.GetVal()
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				logger.Debug("Evaluating 'type' Node", "expr", expr.Print())
-				val := expr.GetVal()
-				if val == nil {
-					return nil, nil, errors.New("expected block type, but found none")
-				}
-				name, ok := val.(string)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected string, but found '%v'", name)
-				}
-				blocks := findBlocksByType(b, name)
-				return blocks, val, nil
+			name, ok := value.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected block type, but found '%v'", value)
+			}
+			self.Do = func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'type' Node", "expr", expr.Print())
+				return findBlocksByType(cfg, r, self, in, name)
 			}
 		case parse.Label:
 			value = expr.GetVal()
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				logger.Debug("Evaluating 'label' Node", "expr", expr.Print())
-				val := expr.GetVal()
-				if val == nil {
-					return nil, nil, errors.New("expected block label, but found none")
-				}
-				name, ok := val.(string)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected string, but found '%v'", name)
-				}
-				blocks := findBlocksByLabel(b, name)
-				return blocks, val, nil
+			name, ok := value.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected block label, but found '%v'", value)
+			}
+			self.Do = func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'label' Node", "expr", expr.Print())
+				return filter(cfg, r, self, in, func(b Node) (bool, error) {
+					ok := hasLabel(cfg, b, name)
+					if ok {
+						r.produced(self)
+					} else {
+						r.consider(self, "label", name, b.Labels)
+					}
+					return ok, nil
+				})
 			}
 		case parse.Attr:
 			value = expr.GetVal()
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				logger.Debug("Evaluating 'attr' Node", "expr", expr.Print())
-				val := expr.GetVal()
-				if val == nil {
-					return nil, nil, errors.New("expected block label, but found none")
-				}
-				name, ok := val.(string)
-				if !ok {
-					return nil, nil, fmt.Errorf("expected string, but found '%v'", name)
-				}
-				blocks, err := findBlocksByAttr(b, name)
-				return blocks, val, err
+			name, ok := value.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("expected attribute name, but found '%v'", value)
+			}
+			self.Do = func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'attr' Node", "expr", expr.Print())
+				return filter(cfg, r, self, in, func(b Node) (bool, error) {
+					ok, err := hasAttr(cfg, b, name)
+					if ok {
+						r.produced(self)
+					} else if err == nil {
+						r.consider(self, "attribute", name, func() []string {
+							return attributeNames(b)
+						})
+					}
+					return ok, err
+				})
+			}
+		case parse.Root:
+			self.Do = func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'root' Node", "expr", expr.Print())
+				return in
 			}
 		case parse.Num, parse.Str:
 			value = expr.GetVal()
-			self.Do = func(b hclsyntax.Blocks) (hclsyntax.Blocks, interface{}, error) {
-				logger.Debug("Evaluating 'literal' Node", "expr", expr.Print())
-				return nil, expr.GetVal(), nil
+			self.Do = func(r *run, in stream) stream {
+				cfg.logger.Debug("Evaluating 'literal' Node", "expr", expr.Print())
+				return fromNodes(nil)
 			}
 		}
 	}
 
-	logger.Debug("Finished Evaluation", "expr", expr.Print())
+	if self.Do != nil {
+		self.Do = traced(self, self.Do)
+	}
+
+	cfg.logger.Debug("Finished Evaluation", "expr", expr.Print())
 	return self, value, nil
 }
 
-func findBlocksByAttr(blocks hclsyntax.Blocks, name string) (hclsyntax.Blocks, error) {
-	var candidates hclsyntax.Blocks = []*hclsyntax.Block{}
-	for _, b := range blocks {
-		attrs, _ := b.Body.JustAttributes()
-		if attrs == nil {
-			return nil, fmt.Errorf("failed to read attributes from block '%v'", b.Type)
-		}
-		if len(attrs) == 0 {
-			continue
-		}
-		for _, a := range attrs {
-			if a.Name == name {
-				candidates = append(candidates, b)
-				break
+func fromNodes(nodes Nodes) stream {
+	return func(yield func(item, error) bool) {
+		for _, n := range nodes {
+			if !yield(item{node: n}, nil) {
+				return
 			}
 		}
 	}
-	return candidates, nil
 }
 
-func findBlocksByLabel(blocks hclsyntax.Blocks, name string) hclsyntax.Blocks {
-	logger.Debug("### findBlocksByLabel")
-	var candidates hclsyntax.Blocks = []*hclsyntax.Block{}
-	logger.Debug("### Blocks", "count", len(blocks))
-	for _, b := range blocks {
-		logger.Debug("### Labels", "block", b.Type, "count", len(b.Labels))
-		for _, l := range b.Labels {
-			if l == name {
-				logger.Debug("Found block with label", "block", b.Type, "label", l)
-				candidates = append(candidates, b)
-				break
+// filter yields the nodes of in for which keep returns true. In lenient mode,
+// nodes for which keep fails are skipped.
+func filter(cfg *config, r *run, e *evaluation, in stream, keep func(Node) (bool, error)) stream {
+	return func(yield func(item, error) bool) {
+		for b, err := range in {
+			if err != nil {
+				yield(item{}, err)
+				return
+			}
+			ok, err := keep(b.node)
+			if err != nil {
+				cfg.logger.Debug("Anomaly in block", "block", b.node.Type(), "err", err)
+				if err := r.anomaly(err); err != nil {
+					yield(item{}, err)
+					return
+				}
+				r.drop(e, b.node)
+				continue
+			}
+			if !ok {
+				r.drop(e, b.node)
+				continue
+			}
+			if !yield(b, nil) {
+				return
 			}
 		}
 	}
-	return candidates
 }
 
-func findBlocksByType(blocks hclsyntax.Blocks, name string) hclsyntax.Blocks {
-	logger.Info("Finding Block by type...", "type", name)
-	var candidates hclsyntax.Blocks = []*hclsyntax.Block{}
-	logger.Debug("### Blocks", "count", len(blocks))
-	for _, b := range blocks {
-		logger.Debug("Examining block", "block", b.Type)
-		if b.Type == name {
-			logger.Debug("Found block", "block", b.Type, "label", b.Type)
-			candidates = append(candidates, b)
-		}
+func hasAttr(cfg *config, b Node, name string) (bool, error) {
+	attrs, err := readAttributes(b)
+	if err != nil {
+		return false, err
 	}
-	return candidates
+	return findAttr(cfg, attrs, name) != nil, nil
 }
 
-func filter(blocks hclsyntax.Blocks, attrName string, attrValue string) (hclsyntax.Blocks, interface{}, error) {
-	var candidateBlocks hclsyntax.Blocks
+func readAttributes(b Node) (hcl.Attributes, error) {
+	attrs, diags := b.Attributes()
+	if attrs == nil {
+		return nil, append(hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read attributes",
+			Detail:   fmt.Sprintf("failed to read attributes from block '%v'", b.Type()),
+			Subject:  b.DefRange().Ptr(),
+		}}, diags...)
+	}
+	return attrs, nil
+}
 
-	for _, b := range blocks {
-		attrs, _ := b.Body.JustAttributes()
-		if attrs == nil {
-			return nil, nil, errors.New("failed to read attributes")
+func findAttr(cfg *config, attrs hcl.Attributes, name string) *hcl.Attribute {
+	if a, ok := attrs[name]; ok || !cfg.ignoreCase {
+		return a
+	}
+	for _, a := range attrs {
+		if cfg.equal(a.Name, name) {
+			return a
 		}
-		if len(attrs) == 0 {
-			continue
+	}
+	return nil
+}
+
+func hasLabel(cfg *config, b Node, name string) bool {
+	cfg.logger.Debug("### Labels", "block", b.Type(), "count", len(b.Labels()))
+	for _, l := range b.Labels() {
+		if cfg.equal(l, name) {
+			cfg.logger.Debug("Found block with label", "block", b.Type(), "label", l)
+			return true
 		}
+	}
+	return false
+}
 
-		for _, a := range attrs {
-			if a.Name != attrName {
-				continue
+func findBlocksByType(cfg *config, r *run, e *evaluation, parents stream, name string) stream {
+	return func(yield func(item, error) bool) {
+		cfg.logger.Info("Finding Block by type...", "type", name)
+		for p, err := range parents {
+			if err != nil {
+				yield(item{}, err)
+				return
 			}
-			if attrValue == "" {
-				candidateBlocks = append(candidateBlocks, b)
-				continue
+			if err := r.stopped(); err != nil {
+				yield(item{}, err)
+				return
+			}
+			blocks, diags := blocksByType(cfg, p.node, name)
+			if diags.HasErrors() {
+				cfg.logger.Debug("Failed to read blocks", "type", name, "diags", diags.Error())
+			}
+			if len(blocks) == 0 {
+				r.consider(e, "block type", name, p.node.BlockTypes)
+			} else {
+				r.produced(e)
+			}
+			for _, b := range blocks {
+				cfg.logger.Debug("Found block", "block", b.Type(), "labels", b.Labels())
+				child := item{node: b, depth: p.depth + 1}
+				if err := r.visit(child); err != nil {
+					yield(item{}, err)
+					return
+				}
+				if !yield(child, nil) {
+					return
+				}
 			}
+		}
+	}
+}
 
-			val, _ := a.Expr.Value(nil)
-			equals, err := cmpval.IsEqual(val, attrValue)
+// findAttrs yields the attribute called name of each parent, as an AttrNode,
+// or as a ModuleNode wrapping one for the parents found in a module.
+func findAttrs(cfg *config, r *run, e *evaluation, parents stream, name string) stream {
+	return func(yield func(item, error) bool) {
+		for p, err := range parents {
 			if err != nil {
-				return nil, nil, fmt.Errorf("failed to test equality: %v", err)
+				yield(item{}, err)
+				return
+			}
+			if err := r.stopped(); err != nil {
+				yield(item{}, err)
+				return
+			}
+			attrs, err := readAttributes(p.node)
+			if err != nil {
+				if err := r.anomaly(err); err != nil {
+					yield(item{}, err)
+					return
+				}
+				continue
 			}
-			if equals {
-				candidateBlocks = append(candidateBlocks, b)
+			a := findAttr(cfg, attrs, name)
+			if a == nil {
+				r.consider(e, "attribute", name, func() []string {
+					return attributeNames(p.node)
+				})
+				continue
+			}
+			r.produced(e)
+			var node Node = NewAttrNode(a)
+			if m, ok := p.node.(*ModuleNode); ok {
+				// keep the call path of attributes read inside modules.
+				node = m.wrap(node)
+			}
+			child := item{node: node, depth: p.depth + 1}
+			if err := r.visit(child); err != nil {
+				yield(item{}, err)
+				return
 			}
+			if !yield(child, nil) {
+				return
+			}
+		}
+	}
+}
+
+func blocksByType(cfg *config, p Node, name string) (Nodes, hcl.Diagnostics) {
+	if !cfg.ignoreCase {
+		return p.Blocks(name)
+	}
+	var blocks Nodes
+	var diags hcl.Diagnostics
+	for _, t := range p.BlockTypes() {
+		if !cfg.equal(t, name) {
+			continue
 		}
+		found, d := p.Blocks(t)
+		blocks = append(blocks, found...)
+		diags = append(diags, d...)
+	}
+	return blocks, diags
+}
+
+func hasAttrValue(cfg *config, b Node, attrName string, attrValue string) (bool, error) {
+	attrs, err := readAttributes(b)
+	if err != nil {
+		return false, err
+	}
+	a := findAttr(cfg, attrs, attrName)
+	if a == nil {
+		return false, nil
+	}
+	if attrValue == "" {
+		return true, nil
+	}
+
+	val, diags := a.Expr.Value(cfg.evalCtx)
+	if diags.HasErrors() {
+		return false, diags
+	}
+	equals, err := cmpval.IsEqual(val, attrValue)
+	if err != nil {
+		return false, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to compare attribute",
+			Detail:   fmt.Sprintf("failed to test equality of '%v': %v", a.Name, err),
+			Subject:  a.Expr.Range().Ptr(),
+		}}
 	}
-	return candidateBlocks, nil, nil
+	return equals, nil
 }
@@ -1,37 +1,150 @@
 package hclpath
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"iter"
 	"reflect"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
-	"github.com/hashicorp/hcl/v2/hclsyntax"
-	"github.com/kdehairy/hclpath/v2/logging"
 )
 
-var logger = logging.NewDefaultLogger()
+// Match is a block found by a query, along with the file it was read from.
+// Module holds the module call path of the block, when module traversal is
+// enabled.
+type Match struct {
+	File   string
+	Node   Node
+	Module []string
+}
 
-func QueryFile(file string, path string) (hclsyntax.Blocks, error) {
+func QueryFile(file string, path string, opts ...Option) (Nodes, error) {
 	hclParser := hclparse.NewParser()
-	hclFile, _ := hclParser.ParseHCLFile("test_cases/test-1.tf")
-	if hclFile == nil {
-		return nil, fmt.Errorf("failed to parse file '%v'", file)
+	var hclFile *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(file, ".json") {
+		hclFile, diags = hclParser.ParseJSONFile(file)
+	} else {
+		hclFile, diags = hclParser.ParseHCLFile(file)
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file '%v': %v", file, diags)
 	}
-	return Query(hclFile.Body, path)
+	return Query(hclFile.Body, path, opts...)
 }
 
-func Query(b hcl.Body, path string) (hclsyntax.Blocks, error) {
-	body := b.(*hclsyntax.Body)
-	logger.Debug("Body received", "body", b, "type", reflect.TypeOf(b))
-	compilation, err := Compile(path)
+// QueryFS evaluates path against every .tf, .tfvars and .hcl file of fsys, or
+// their JSON variants, whose name matches glob. glob follows the syntax of
+// fs.Glob. All files are parsed through a single parser, and matches are
+// returned in file order.
+func QueryFS(fsys fs.FS, glob string, path string, opts ...Option) ([]Match, error) {
+	matches := []Match{}
+	for m, err := range QueryFSAll(fsys, glob, path, opts...) {
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
+
+// QueryFSAll is the lazy form of QueryFS. Files are only parsed as the
+// sequence is consumed, so stopping at the first match skips the remaining
+// files.
+func QueryFSAll(fsys fs.FS, glob string, path string, opts ...Option) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		names, err := fs.Glob(fsys, glob)
+		if err != nil {
+			yield(Match{}, fmt.Errorf("invalid glob '%v': %v", glob, err))
+			return
+		}
+		compilation, err := Compile(path, opts...)
+		if err != nil {
+			yield(Match{}, err)
+			return
+		}
+
+		hclParser := hclparse.NewParser()
+		for _, name := range names {
+			if !IsConfigFile(name) {
+				continue
+			}
+			hclFile, err := parseFSFile(hclParser, fsys, name)
+			if err != nil {
+				yield(Match{}, err)
+				return
+			}
+			for b, err := range compilation.All(Nodes{NewNode(hclFile.Body)}) {
+				if err != nil {
+					yield(Match{}, fmt.Errorf("failed to query file '%v': %v", name, err))
+					return
+				}
+				if !yield(Match{File: name, Node: b}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// IsConfigFile reports whether name is that of a .tf, .tfvars or .hcl file,
+// or of their JSON variants.
+func IsConfigFile(name string) bool {
+	name = strings.TrimSuffix(name, ".json")
+	return strings.HasSuffix(name, ".tf") ||
+		strings.HasSuffix(name, ".tfvars") ||
+		strings.HasSuffix(name, ".hcl")
+}
+
+func parseFSFile(hclParser *hclparse.Parser, fsys fs.FS, name string) (*hcl.File, error) {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file '%v': %v", name, err)
+	}
+	var hclFile *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(name, ".json") {
+		hclFile, diags = hclParser.ParseJSON(src, name)
+	} else {
+		hclFile, diags = hclParser.ParseHCL(src, name)
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file '%v': %v", name, diags)
+	}
+	return hclFile, nil
+}
+
+// Query evaluates path against any hcl.Body, whether it was parsed from native
+// syntax, from JSON, or merged from several files.
+func Query(b hcl.Body, path string, opts ...Option) (Nodes, error) {
+	compilation, err := Compile(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	compilation.cfg.logger.Debug("Body received", "body", b, "type", reflect.TypeOf(b))
+	return compilation.Exec(Nodes{NewNode(b)})
+}
+
+// QueryResult is like Query, but also returns the warnings collected in
+// lenient mode.
+func QueryResult(b hcl.Body, path string, opts ...Option) (*Result, error) {
+	compilation, err := Compile(path, opts...)
 	if err != nil {
 		return nil, err
 	}
-	blocks := body.Blocks
-	if len(blocks) == 0 {
-		logger.Debug("No blocks in the passed body")
-		return hclsyntax.Blocks{}, nil
+	return compilation.Run(context.Background(), Nodes{NewNode(b)})
+}
+
+// QueryAll is the lazy form of Query.
+func QueryAll(b hcl.Body, path string, opts ...Option) iter.Seq2[Node, error] {
+	compilation, err := Compile(path, opts...)
+	if err != nil {
+		return func(yield func(Node, error) bool) {
+			yield(nil, err)
+		}
 	}
-	return compilation.Exec(blocks)
+	return compilation.All(Nodes{NewNode(b)})
 }
@@ -1,8 +1,24 @@
 package hclpath
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kdehairy/hclpath/v2/parse"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type TestCase struct {
@@ -86,13 +102,199 @@ func TestHclPath(t *testing.T) {
 			test:     "provider:aws[1]{alias='infra-account'}",
 			expected: 1,
 		},
+		{
+			name:     "quoted label with a dot",
+			fixture:  "test-3.hcl",
+			test:     `provider:"aws.west"{region='us-west-2'}`,
+			expected: 1,
+		},
+		{
+			name:     "quoted label with a space",
+			fixture:  "test-3.hcl",
+			test:     `job:'dépôt nocturne'/tâche:café`,
+			expected: 1,
+		},
+		{
+			name:     "quoted type",
+			fixture:  "test-3.hcl",
+			test:     `"source":'amazon-ebs':ubuntu`,
+			expected: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			blocks, err := QueryFile("test_cases/"+tc.fixture, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(blocks) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(blocks))
+			}
+		})
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	cases := []TestCase{
+		{
+			name:     "block without label",
+			fixture:  "test-1.tf.json",
+			test:     "terraform",
+			expected: 1,
+		},
+		{
+			name:     "block with label and label in path",
+			fixture:  "test-1.tf.json",
+			test:     "provider:aws",
+			expected: 2,
+		},
+		{
+			name:     "child block with label",
+			fixture:  "test-1.tf.json",
+			test:     "terraform/backend:s3",
+			expected: 1,
+		},
+		{
+			name:     "child block to a block with label",
+			fixture:  "test-1.tf.json",
+			test:     "provider:aws/assume_role",
+			expected: 1,
+		},
+		{
+			name:     "child block is not an attribute",
+			fixture:  "test-1.tf.json",
+			test:     "terraform{backend}",
+			expected: 0,
+		},
+		{
+			name:     "block with label and attr name and value",
+			fixture:  "test-1.tf.json",
+			test:     "provider:aws{alias='infra-account'}",
+			expected: 1,
+		},
+		{
+			name:     "attribute value integer",
+			fixture:  "test-1.tf.json",
+			test:     "locals{app_version='1'}",
+			expected: 1,
+		},
+		{
+			name:     "one block of multiple further filtered",
+			fixture:  "test-1.tf.json",
+			test:     "provider:aws[1]{alias='infra-account'}",
+			expected: 1,
+		},
+		{
+			name:     "block holding only a block",
+			fixture:  "test-5.tf.json",
+			test:     "terraform/required_providers{aws}",
+			expected: 1,
+		},
+		{
+			name:     "block holding only a block is not labelled",
+			fixture:  "test-5.tf.json",
+			test:     "terraform:required_providers",
+			expected: 0,
+		},
+		{
+			name:     "resource holding only a nested object",
+			fixture:  "test-5.tf.json",
+			test:     "resource:aws_s3_bucket:logs/versioning{enabled}",
+			expected: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			hclFile, diags := hclparse.NewParser().ParseJSONFile("test_cases/" + tc.fixture)
+			if diags.HasErrors() {
+				t.Fatalf("failed to parse file: %v", diags)
+			}
+			blocks, err := Query(hclFile.Body, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(blocks) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(blocks))
+			}
+		})
+	}
+}
+
+func TestQueryMerged(t *testing.T) {
+	cases := []TestCase{
+		{
+			name:     "blocks from both files",
+			test:     "provider:aws",
+			expected: 3,
+		},
+		{
+			name:     "block from the second file",
+			test:     "provider:aws{alias='prod-account'}",
+			expected: 1,
+		},
+		{
+			name:     "block with two labels",
+			test:     "resource:deployer",
+			expected: 1,
+		},
+		{
+			name:     "child block of a merged body",
+			test:     "terraform/backend:s3",
+			expected: 1,
+		},
+	}
+
+	hclParser := hclparse.NewParser()
+	var files []*hcl.File
+	for _, name := range []string{"test_cases/test-1.tf", "test_cases/test-2.tf"} {
+		hclFile, diags := hclParser.ParseHCLFile(name)
+		if diags.HasErrors() {
+			t.Fatalf("failed to parse file: %v", diags)
+		}
+		files = append(files, hclFile)
 	}
+	body := hcl.MergeFiles(files)
 
 	for _, tc := range cases {
 		testName := strings.ReplaceAll(tc.name, " ", "_")
 		testName = strings.ToLower(testName)
 		t.Run(testName, func(t *testing.T) {
-			blocks, err := QueryFile("test_cases/test-1.tf", tc.test)
+			blocks, err := Query(body, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(blocks) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(blocks))
+			}
+		})
+	}
+
+	ignoreCase := []TestCase{
+		{
+			name:     "blocks from both files",
+			test:     "PROVIDER:AWS",
+			expected: 3,
+		},
+		{
+			name:     "child block of a merged body",
+			test:     "Terraform/Backend:S3",
+			expected: 1,
+		},
+	}
+	for _, tc := range ignoreCase {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run("ignore_case_"+testName, func(t *testing.T) {
+			blocks, err := Query(body, tc.test, WithIgnoreCase())
 			if err != nil {
 				t.Fatalf("failed to find block: %v", err)
 			}
@@ -103,3 +305,2178 @@ func TestHclPath(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.tf": {Data: []byte(`
+provider "aws" {
+  region = "eu-central-1"
+}
+`)},
+		"providers.tf.json": {Data: []byte(`{
+  "provider": {
+    "aws": {
+      "alias": "infra-account",
+      "region": "eu-central-1"
+    }
+  }
+}`)},
+		"nomad.hcl": {Data: []byte(`
+job "web" {
+  datacenters = ["dc1"]
+}
+`)},
+		"prod.tfvars":            {Data: []byte(`environment = "prod"`)},
+		"README.md":              {Data: []byte("provider \"aws\" {}")},
+		"modules/app/main.tf":    {Data: []byte("provider \"aws\" {}")},
+		"modules/app/outputs.tf": {Data: []byte("")},
+		"broken/main.tf":         {Data: []byte("provider \"aws\" {\n")},
+	}
+
+	cases := []struct {
+		name     string
+		glob     string
+		test     string
+		expected []string
+	}{
+		{
+			name:     "all files of the root",
+			glob:     "*",
+			test:     "provider:aws",
+			expected: []string{"main.tf", "providers.tf.json"},
+		},
+		{
+			name:     "hcl files",
+			glob:     "*.hcl",
+			test:     "job:web",
+			expected: []string{"nomad.hcl"},
+		},
+		{
+			name:     "files of a module",
+			glob:     "modules/app/*.tf",
+			test:     "provider:aws",
+			expected: []string{"modules/app/main.tf"},
+		},
+		{
+			name:     "filtered across files",
+			glob:     "*",
+			test:     "provider:aws{alias='infra-account'}",
+			expected: []string{"providers.tf.json"},
+		},
+		{
+			name:     "no matching files",
+			glob:     "*.tfvars",
+			test:     "provider",
+			expected: []string{},
+		},
+		{
+			name:     "variable files",
+			glob:     "*",
+			test:     ".{environment='prod'}",
+			expected: []string{"prod.tfvars"},
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			matches, err := QueryFS(fsys, tc.glob, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(matches) != len(tc.expected) {
+				t.Fatalf("Expected '%v' but found '%v'", len(tc.expected), len(matches))
+			}
+			for i, m := range matches {
+				if m.File != tc.expected[i] {
+					t.Errorf("Expected file '%v' but found '%v'", tc.expected[i], m.File)
+				}
+			}
+		})
+	}
+
+	t.Run("syntax_error_in_a_file", func(t *testing.T) {
+		_, err := QueryFS(fsys, "broken/*", "provider")
+		if err == nil {
+			t.Fatal("Expected an error for a file that does not parse")
+		}
+	})
+}
+
+func TestRootAttributes(t *testing.T) {
+	cases := []struct {
+		name     string
+		fixture  string
+		test     string
+		expected []string
+	}{
+		{
+			name:     "root",
+			fixture:  "test-4.tfvars",
+			test:     ".",
+			expected: []string{""},
+		},
+		{
+			name:     "root filtered",
+			fixture:  "test-4.tfvars",
+			test:     ".{environment='prod'}",
+			expected: []string{""},
+		},
+		{
+			name:     "root filtered out",
+			fixture:  "test-4.tfvars",
+			test:     ".{environment='dev'}",
+			expected: []string{},
+		},
+		{
+			name:     "root attribute",
+			fixture:  "test-4.tfvars",
+			test:     "/@region",
+			expected: []string{"@region"},
+		},
+		{
+			name:     "attribute of a filtered root",
+			fixture:  "test-4.tfvars",
+			test:     ".{environment='prod'}/@instances",
+			expected: []string{"@instances"},
+		},
+		{
+			name:     "missing root attribute",
+			fixture:  "test-4.tfvars",
+			test:     "/@zone",
+			expected: []string{},
+		},
+		{
+			name:     "root blocks",
+			fixture:  "test-1.tf",
+			test:     "./provider:aws",
+			expected: []string{"provider", "provider"},
+		},
+		{
+			name:     "block attributes",
+			fixture:  "test-1.tf",
+			test:     "provider:aws/@alias",
+			expected: []string{"@alias"},
+		},
+		{
+			name:     "selected attribute",
+			fixture:  "test-1.tf",
+			test:     "provider:aws/@region[1]",
+			expected: []string{"@region"},
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			nodes, err := QueryFile("test_cases/"+tc.fixture, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			if len(nodes) != len(tc.expected) {
+				t.Fatalf("Expected '%v' but found '%v'", len(tc.expected), len(nodes))
+			}
+			for i, n := range nodes {
+				if n.Type() != tc.expected[i] {
+					t.Errorf("Expected '%v' but found '%v'", tc.expected[i], n.Type())
+				}
+			}
+		})
+	}
+
+	t.Run("attribute_value", func(t *testing.T) {
+		nodes, err := QueryFile("test_cases/test-4.tfvars", "/@region")
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		val, diags := nodes[0].(*AttrNode).Attribute().Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("failed to evaluate attribute: %v", diags)
+		}
+		if !val.RawEquals(cty.StringVal("eu-west-1")) {
+			t.Errorf("Expected 'eu-west-1' but found '%v'", val.GoString())
+		}
+	})
+
+	t.Run("suggestions", func(t *testing.T) {
+		hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-4.tfvars")
+		if diags.HasErrors() {
+			t.Fatalf("failed to parse file: %v", diags)
+		}
+		result, err := QueryResult(hclFile.Body, "/@regoin")
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if len(result.Suggestions) != 1 || result.Suggestions[0].Names[0] != "region" {
+			t.Errorf("Expected a suggestion of 'region' but found '%v'", result.Suggestions)
+		}
+	})
+}
+
+func TestQueryModule(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.tf": {Data: []byte(`
+module "app" {
+  source = "./modules/app"
+}
+
+module "vpc" {
+  source = "terraform-aws-modules/vpc/aws"
+}
+
+resource "aws_iam_role" "root" {
+  name = "root"
+}
+`)},
+		"modules/app/main.tf": {Data: []byte(`
+resource "aws_iam_role" "app" {
+  name = "app"
+}
+
+module "worker" {
+  source = "../worker"
+}
+`)},
+		"modules/app/roles.tf.json": {Data: []byte(`{
+  "resource": {
+    "aws_iam_role": {
+      "app_admin": {
+        "name": "app-admin"
+      }
+    }
+  }
+}`)},
+		"modules/worker/main.tf": {Data: []byte(`
+resource "aws_iam_role" "worker" {
+  name = "worker"
+}
+`)},
+		"cycle/main.tf": {Data: []byte(`
+module "self" {
+  source = "./"
+}
+`)},
+		"broken/main.tf": {Data: []byte(`
+module "app" {
+  source = "../modules/app"
+`)},
+	}
+
+	cases := []struct {
+		name     string
+		dir      string
+		test     string
+		expected [][]string
+	}{
+		{
+			name:     "root module only",
+			dir:      ".",
+			test:     "resource:aws_iam_role",
+			expected: [][]string{nil},
+		},
+		{
+			name:     "into a local module",
+			dir:      ".",
+			test:     "module:app/>>resource:aws_iam_role",
+			expected: [][]string{{"app"}, {"app"}},
+		},
+		{
+			name:     "into a nested module",
+			dir:      ".",
+			test:     "module:app/>>module:worker/>>resource:aws_iam_role",
+			expected: [][]string{{"app", "worker"}},
+		},
+		{
+			name:     "remote modules are skipped",
+			dir:      ".",
+			test:     "module/>>resource",
+			expected: [][]string{{"app"}, {"app"}},
+		},
+		{
+			name:     "filtered inside a module",
+			dir:      ".",
+			test:     "module:app/>>resource:aws_iam_role{name='app-admin'}",
+			expected: [][]string{{"app"}},
+		},
+		{
+			name:     "attributes inside a module",
+			dir:      ".",
+			test:     "module:app/>>module:worker/>>resource:aws_iam_role/@name",
+			expected: [][]string{{"app", "worker"}},
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			matches, err := QueryModule(fsys, tc.dir, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(matches) != len(tc.expected) {
+				t.Fatalf("Expected '%v' but found '%v'", len(tc.expected), len(matches))
+			}
+			for i, m := range matches {
+				if strings.Join(m.Module, ".") != strings.Join(tc.expected[i], ".") {
+					t.Errorf("Expected module '%v' but found '%v'", tc.expected[i], m.Module)
+				}
+			}
+		})
+	}
+
+	t.Run("ignore_case", func(t *testing.T) {
+		matches, err := QueryModule(fsys, ".", "MODULE:APP/>>RESOURCE:AWS_IAM_ROLE", WithIgnoreCase())
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if len(matches) != 2 {
+			t.Errorf("Expected '%v' but found '%v'", 2, len(matches))
+		}
+	})
+
+	t.Run("module_cycle", func(t *testing.T) {
+		_, err := QueryModule(fsys, "cycle", "module/>>module/>>module")
+		if err == nil {
+			t.Fatal("Expected a module cycle error")
+		}
+	})
+
+	t.Run("syntax_error_in_a_module", func(t *testing.T) {
+		_, err := QueryModule(fsys, "broken", "module")
+		if err == nil {
+			t.Fatal("Expected an error for a module that does not parse")
+		}
+	})
+
+	t.Run("not_enabled", func(t *testing.T) {
+		_, err := QueryFile("test_cases/test-1.tf", "module/>>resource")
+		if err == nil {
+			t.Fatal("Expected an error when module traversal is not enabled")
+		}
+	})
+}
+
+type countingNode struct {
+	Node
+	attributes *int
+}
+
+func (n *countingNode) Attributes() (hcl.Attributes, hcl.Diagnostics) {
+	*n.attributes++
+	return n.Node.Attributes()
+}
+
+func (n *countingNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	blocks, diags := n.Node.Blocks(typeName)
+	nodes := Nodes{}
+	for _, b := range blocks {
+		nodes = append(nodes, &countingNode{Node: b, attributes: n.attributes})
+	}
+	return nodes, diags
+}
+
+type countingFS struct {
+	fstest.MapFS
+	opened int
+}
+
+func (fsys *countingFS) ReadFile(name string) ([]byte, error) {
+	fsys.opened++
+	return fsys.MapFS.ReadFile(name)
+}
+
+func TestLazyEvaluation(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+
+	cases := []struct {
+		name       string
+		test       string
+		first      bool
+		attributes int
+	}{
+		{
+			name:       "select stops at the index",
+			test:       "provider{region}[0]",
+			attributes: 1,
+		},
+		{
+			name:       "select reads every block before the index",
+			test:       "provider{region}[1]",
+			attributes: 2,
+		},
+		{
+			name:       "first stops at the first match",
+			test:       "provider{region}",
+			first:      true,
+			attributes: 1,
+		},
+		{
+			name:       "exec reads every block",
+			test:       "provider{region}",
+			attributes: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			compilation, err := Compile(tc.test)
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			attributes := 0
+			root := &countingNode{Node: NewNode(hclFile.Body), attributes: &attributes}
+			if tc.first {
+				_, err = compilation.First(Nodes{root})
+			} else {
+				_, err = compilation.Exec(Nodes{root})
+			}
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			if attributes != tc.attributes {
+				t.Errorf("Expected '%v' attribute reads but found '%v'", tc.attributes, attributes)
+			}
+		})
+	}
+
+	t.Run("files_are_parsed_lazily", func(t *testing.T) {
+		fsys := &countingFS{MapFS: fstest.MapFS{
+			"a.tf": {Data: []byte(`provider "aws" {}`)},
+			"b.tf": {Data: []byte(`provider "aws" {}`)},
+			"c.tf": {Data: []byte(`provider "aws" {}`)},
+		}}
+		for _, err := range QueryFSAll(fsys, "*.tf", "provider:aws") {
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			break
+		}
+		if fsys.opened != 1 {
+			t.Errorf("Expected '1' file to be opened but found '%v'", fsys.opened)
+		}
+	})
+}
+
+type slowNode struct {
+	Node
+}
+
+func (n *slowNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	time.Sleep(10 * time.Millisecond)
+	return n.Node.Blocks(typeName)
+}
+
+func TestLimits(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+	root := Nodes{NewNode(hclFile.Body)}
+
+	cases := []struct {
+		name     string
+		test     string
+		limits   Limits
+		exceeded bool
+	}{
+		{
+			name:   "results within limit",
+			test:   "provider:aws",
+			limits: Limits{MaxResults: 2},
+		},
+		{
+			name:     "results over limit",
+			test:     "provider:aws",
+			limits:   Limits{MaxResults: 1},
+			exceeded: true,
+		},
+		{
+			name:   "depth within limit",
+			test:   "provider/assume_role",
+			limits: Limits{MaxDepth: 2},
+		},
+		{
+			name:     "depth over limit",
+			test:     "provider/assume_role",
+			limits:   Limits{MaxDepth: 1},
+			exceeded: true,
+		},
+		{
+			name:   "visited within limit",
+			test:   "provider",
+			limits: Limits{MaxVisited: 2},
+		},
+		{
+			name:     "visited over limit",
+			test:     "provider/assume_role",
+			limits:   Limits{MaxVisited: 2},
+			exceeded: true,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			compilation, err := Compile(tc.test, WithLimits(tc.limits))
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			_, err = compilation.Exec(root)
+			if tc.exceeded && !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("Expected '%v' but found '%v'", ErrLimitExceeded, err)
+			}
+			if !tc.exceeded && err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+		})
+	}
+
+	t.Run("cancelled_context", func(t *testing.T) {
+		compilation, err := Compile("provider")
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = compilation.ExecContext(ctx, root)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected '%v' but found '%v'", context.Canceled, err)
+		}
+		if errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Expected no limit error but found '%v'", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		compilation, err := Compile("provider", WithLimits(Limits{Timeout: time.Millisecond}))
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		_, err = compilation.Exec(Nodes{&slowNode{root[0]}})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected '%v' but found '%v'", context.DeadlineExceeded, err)
+		}
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "timeout" {
+			t.Errorf("Expected a '%v' limit error but found '%v'", "timeout", err)
+		}
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Expected '%v' but found '%v'", ErrLimitExceeded, err)
+		}
+	})
+}
+
+func TestOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		test     string
+		opts     []Option
+		expected int
+	}{
+		{
+			name:     "case sensitive by default",
+			test:     "Provider:AWS",
+			expected: 0,
+		},
+		{
+			name:     "ignore case of types and labels",
+			test:     "Provider:AWS",
+			opts:     []Option{WithIgnoreCase()},
+			expected: 2,
+		},
+		{
+			name:     "ignore case of attribute names",
+			test:     "provider:aws{ALIAS='infra-account'}",
+			opts:     []Option{WithIgnoreCase()},
+			expected: 1,
+		},
+		{
+			name: "eval context",
+			test: "locals{cba_base_domain='example.com'}",
+			opts: []Option{WithEvalContext(&hcl.EvalContext{
+				Variables: map[string]cty.Value{
+					"var": cty.ObjectVal(map[string]cty.Value{
+						"cba_base_domain": cty.StringVal("example.com"),
+					}),
+				},
+			})},
+			expected: 1,
+		},
+		{
+			name:     "lenient index out of bound",
+			test:     "provider:aws[5]",
+			opts:     []Option{WithMode(Lenient)},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			blocks, err := QueryFile("test_cases/test-1.tf", tc.test, tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+
+			if len(blocks) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(blocks))
+			}
+		})
+	}
+
+	t.Run("logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		_, err := QueryFile("test_cases/test-1.tf", "provider", WithLogger(logger))
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if !strings.Contains(buf.String(), "Finding Block by type...") {
+			t.Errorf("Expected the injected logger to be used, but found '%v'", buf.String())
+		}
+	})
+}
+
+type nilAttrsNode struct {
+	Node
+}
+
+func (n *nilAttrsNode) Attributes() (hcl.Attributes, hcl.Diagnostics) {
+	return nil, nil
+}
+
+func (n *nilAttrsNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	blocks, diags := n.Node.Blocks(typeName)
+	nodes := Nodes{}
+	for _, b := range blocks {
+		nodes = append(nodes, &nilAttrsNode{Node: b})
+	}
+	return nodes, diags
+}
+
+func TestModes(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+
+	cases := []struct {
+		name     string
+		test     string
+		root     Node
+		expected int
+		warnings int
+	}{
+		{
+			name:     "index out of bound",
+			test:     "provider:aws[5]",
+			expected: 0,
+			warnings: 1,
+		},
+		{
+			name:     "unsupported attribute type",
+			test:     "terraform/backend:s3{encrypt='true'}",
+			expected: 0,
+			warnings: 1,
+		},
+		{
+			name:     "literal not convertible to attribute type",
+			test:     "locals{app_version='one'}",
+			expected: 0,
+			warnings: 1,
+		},
+		{
+			name:     "attribute value fails to evaluate",
+			test:     "locals{cba_base_domain='example.com'}",
+			expected: 0,
+			warnings: 1,
+		},
+		{
+			name:     "attributes fail to be read",
+			test:     "provider{alias}",
+			root:     &nilAttrsNode{NewNode(hclFile.Body)},
+			expected: 0,
+			warnings: 2,
+		},
+		{
+			name:     "only the failing blocks are skipped",
+			test:     "locals{app_name='bruno-beans'}",
+			expected: 1,
+			warnings: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		root := tc.root
+		if root == nil {
+			root = NewNode(hclFile.Body)
+		}
+		t.Run(testName+"_strict", func(t *testing.T) {
+			compilation, err := Compile(tc.test, WithMode(Strict))
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			_, err = compilation.Exec(Nodes{root})
+			if tc.warnings == 0 {
+				if err != nil {
+					t.Fatalf("failed to find block: %v", err)
+				}
+				return
+			}
+			var diags hcl.Diagnostics
+			if !errors.As(err, &diags) {
+				t.Fatalf("Expected diagnostics but found '%v'", err)
+			}
+			if diags[0].Subject == nil {
+				t.Errorf("Expected a positioned error but found '%v'", err)
+			}
+		})
+		t.Run(testName+"_lenient", func(t *testing.T) {
+			compilation, err := Compile(tc.test, WithMode(Lenient))
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			res, err := compilation.Run(context.Background(), Nodes{root})
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			if len(res.Nodes) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(res.Nodes))
+			}
+			if len(res.Warnings) != tc.warnings {
+				t.Errorf("Expected '%v' warnings but found '%v'", tc.warnings, len(res.Warnings))
+			}
+			for _, w := range res.Warnings {
+				if w.Severity != hcl.DiagWarning {
+					t.Errorf("Expected a warning but found '%v'", w)
+				}
+			}
+		})
+	}
+}
+
+func TestTrace(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+
+	res, err := QueryResult(hclFile.Body, "provider:aws{alias='nope'}/assume_role", WithTrace())
+	if err != nil {
+		t.Fatalf("failed to find block: %v", err)
+	}
+	root := res.Trace
+	if root == nil {
+		t.Fatal("Expected a trace but found none")
+	}
+
+	cases := []struct {
+		name    string
+		trace   *Trace
+		in      int
+		out     int
+		dropped int
+	}{
+		{
+			name:  "query",
+			trace: root,
+			in:    1,
+			out:   0,
+		},
+		{
+			name:  "type",
+			trace: root.Left.Left.Left,
+			in:    1,
+			out:   2,
+		},
+		{
+			name:  "label",
+			trace: root.Left.Left.Right,
+			in:    2,
+			out:   2,
+		},
+		{
+			name:    "attr",
+			trace:   root.Left.Right.Left,
+			in:      2,
+			out:     1,
+			dropped: 1,
+		},
+		{
+			name:    "attr value",
+			trace:   root.Left.Right,
+			in:      2,
+			out:     0,
+			dropped: 1,
+		},
+		{
+			name:  "child type",
+			trace: root.Right,
+			in:    0,
+			out:   0,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			if tc.trace.In != tc.in {
+				t.Errorf("Expected '%v' in but found '%v'", tc.in, tc.trace.In)
+			}
+			if tc.trace.Out != tc.out {
+				t.Errorf("Expected '%v' out but found '%v'", tc.out, tc.trace.Out)
+			}
+			if len(tc.trace.Dropped) != tc.dropped {
+				t.Errorf("Expected '%v' dropped but found '%v'", tc.dropped, len(tc.trace.Dropped))
+			}
+		})
+	}
+
+	t.Run("render", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(root.String()), "\n")
+		if !strings.HasPrefix(lines[0], root.Expr.Print()) {
+			t.Errorf("Expected the first line to start with '%v' but found '%v'", root.Expr.Print(), lines[0])
+		}
+		if !strings.Contains(root.String(), "└─ assume_role  in=0 out=0") {
+			t.Errorf("Expected the child type in the tree but found:\n%v", root.String())
+		}
+	})
+
+	t.Run("no_trace_by_default", func(t *testing.T) {
+		res, err := QueryResult(hclFile.Body, "provider")
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if res.Trace != nil {
+			t.Errorf("Expected no trace but found one")
+		}
+	})
+}
+
+func TestSuggestions(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+
+	cases := []struct {
+		name     string
+		test     string
+		expected []Suggestion
+	}{
+		{
+			name: "block type",
+			test: "providr:aws",
+			expected: []Suggestion{
+				{Kind: "block type", Given: "providr", Names: []string{"provider"}},
+			},
+		},
+		{
+			name: "child block type",
+			test: "terraform/backnd",
+			expected: []Suggestion{
+				{Kind: "block type", Given: "backnd", Names: []string{"backend"}},
+			},
+		},
+		{
+			name: "label",
+			test: "terraform/backend:s4",
+			expected: []Suggestion{
+				{Kind: "label", Given: "s4", Names: []string{"s3"}},
+			},
+		},
+		{
+			name: "attribute",
+			test: "provider:aws{alais='infra-account'}",
+			expected: []Suggestion{
+				{Kind: "attribute", Given: "alais", Names: []string{"alias"}},
+			},
+		},
+		{
+			name:     "nothing close",
+			test:     "something",
+			expected: []Suggestion{},
+		},
+		{
+			name:     "no suggestions for matches",
+			test:     "provider:aws",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			res, err := QueryResult(hclFile.Body, tc.test)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			if !reflect.DeepEqual(res.Suggestions, tc.expected) {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, res.Suggestions)
+			}
+		})
+	}
+
+	t.Run("render", func(t *testing.T) {
+		s := Suggestion{Kind: "block type", Given: "providr", Names: []string{"provider"}}
+		expected := "no block type 'providr' found, did you mean 'provider'?"
+		if s.String() != expected {
+			t.Errorf("Expected '%v' but found '%v'", expected, s.String())
+		}
+	})
+}
+
+func TestConcurrentExec(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+	root := Nodes{NewNode(hclFile.Body)}
+	compilation, err := Compile("provider:aws{region='eu-central-1'}/assume_role", WithTrace(), WithMode(Lenient))
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				res, err := compilation.Run(context.Background(), root)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(res.Nodes) != 1 || res.Trace.Out != 1 {
+					errs <- fmt.Errorf("Expected '1' but found '%v'", len(res.Nodes))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	t.Run("normalized_hits", func(t *testing.T) {
+		cache := NewCompileCache(2)
+		a, err := cache.Compile("provider:aws{alias='x'}")
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		b, err := cache.Compile(`provider : aws { alias = "x" }`)
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		if a != b {
+			t.Error("Expected equivalent queries to share a compilation")
+		}
+		if cache.Len() != 1 {
+			t.Errorf("Expected '1' entry but found '%v'", cache.Len())
+		}
+	})
+
+	t.Run("least_recently_used_evicted", func(t *testing.T) {
+		cache := NewCompileCache(2)
+		first, _ := cache.Compile("provider")
+		cache.Compile("terraform")
+		cache.Compile("provider")
+		cache.Compile("locals")
+		if cache.Len() != 2 {
+			t.Fatalf("Expected '2' entries but found '%v'", cache.Len())
+		}
+		again, _ := cache.Compile("provider")
+		if again != first {
+			t.Error("Expected the recently used compilation to be kept")
+		}
+		cache.Compile("terraform")
+		if cache.Len() != 2 {
+			t.Errorf("Expected '2' entries but found '%v'", cache.Len())
+		}
+	})
+
+	t.Run("spellings_cached", func(t *testing.T) {
+		cache := NewCompileCache(1)
+		cache.Compile("provider:aws{alias='x'}")
+		cache.Compile(`provider : aws { alias = "x" }`)
+		// the first spelling is the normalized text; the second is kept as
+		// well, so that it then hits without being parsed.
+		if len(cache.entries) != 2 {
+			t.Errorf("Expected '2' keys but found '%v'", len(cache.entries))
+		}
+		cache.Compile("terraform")
+		if len(cache.entries) != 1 {
+			t.Errorf("Expected '1' key but found '%v'", len(cache.entries))
+		}
+	})
+
+	t.Run("no_caching", func(t *testing.T) {
+		for _, size := range []int{0, -1} {
+			cache := NewCompileCache(size)
+			a, err := cache.Compile("provider")
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			b, _ := cache.Compile("provider")
+			if a == b {
+				t.Error("Expected a new compilation on every call")
+			}
+			if cache.Len() != 0 {
+				t.Errorf("Expected '0' entries but found '%v'", cache.Len())
+			}
+		}
+	})
+
+	t.Run("errors_not_cached", func(t *testing.T) {
+		cache := NewCompileCache(2)
+		if _, err := cache.Compile("provider["); err == nil {
+			t.Fatal("Expected a syntax error")
+		}
+		if cache.Len() != 0 {
+			t.Errorf("Expected '0' entries but found '%v'", cache.Len())
+		}
+	})
+
+	t.Run("trailing_input_not_a_hit", func(t *testing.T) {
+		cache := NewCompileCache(2)
+		if _, err := cache.Compile("provider"); err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		if _, err := cache.Compile("provider aws"); err == nil {
+			t.Fatal("Expected a syntax error")
+		}
+	})
+
+	t.Run("concurrent_use", func(t *testing.T) {
+		cache := NewCompileCache(4)
+		queries := []string{"provider", "terraform", "locals", "module", "data", "provider:aws"}
+		var wg sync.WaitGroup
+		for i := range 16 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range 100 {
+					if _, err := cache.Compile(queries[(i+j)%len(queries)]); err != nil {
+						t.Errorf("failed to compile: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if cache.Len() > 4 {
+			t.Errorf("Expected at most '4' entries but found '%v'", cache.Len())
+		}
+	})
+}
+
+func TestCompileExpr(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+	root := Nodes{NewNode(hclFile.Body)}
+
+	t.Run("rewritten_alias", func(t *testing.T) {
+		p := parse.NewParser(strings.NewReader("infra{alias='infra-account'}/assume_role"))
+		expr, err := p.Parse()
+		if err != nil {
+			t.Fatalf("failed to parse: %v", err)
+		}
+		expr = parse.Rewrite(expr, func(e parse.Expr) parse.Expr {
+			if e.GetType() == parse.Type && e.GetVal() == "infra" {
+				return parse.NewBinOp(parse.LblOp, parse.NewIdent(parse.Type, "provider"), parse.NewIdent(parse.Label, "aws"))
+			}
+			return e
+		})
+		compilation, err := CompileExpr(expr)
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		blocks, err := compilation.Exec(root)
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if len(blocks) != 1 {
+			t.Errorf("Expected '1' but found '%v'", len(blocks))
+		}
+	})
+
+	invalid := []struct {
+		name string
+		expr parse.Expr
+	}{
+		{
+			name: "nil expression",
+			expr: nil,
+		},
+		{
+			name: "missing side",
+			expr: &parse.BinOp{Op: parse.NstOp, Lhs: parse.NewIdent(parse.Type, "provider")},
+		},
+		{
+			name: "unknown operator",
+			expr: parse.NewBinOp("?", parse.NewIdent(parse.Type, "a"), parse.NewIdent(parse.Type, "b")),
+		},
+		{
+			name: "unknown identifier type",
+			expr: parse.NewIdent("other", "a"),
+		},
+	}
+	for _, tc := range invalid {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			if _, err := CompileExpr(tc.expr); err == nil {
+				t.Error("Expected an error for an invalid expression")
+			}
+		})
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	hclFile, diags := hclparse.NewParser().ParseHCLFile("test_cases/test-1.tf")
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+	root := Nodes{NewNode(hclFile.Body)}
+
+	cases := []struct {
+		name     string
+		builder  *Builder
+		test     string
+		expected int
+	}{
+		{
+			name:     "child of a labeled block",
+			builder:  Type("provider").Label("aws").Where(Attr("alias").Eq(cty.StringVal("infra-account"))).Child("assume_role"),
+			test:     "provider:aws{alias='infra-account'}/assume_role",
+			expected: 1,
+		},
+		{
+			name:     "attribute name only",
+			builder:  Type("provider").Label("aws").Where(Attr("alias")),
+			test:     "provider:aws{alias}",
+			expected: 1,
+		},
+		{
+			name:     "number value",
+			builder:  Type("locals").Where(Attr("app_float").Eq(cty.NumberFloatVal(1.45))),
+			test:     "locals{app_float='1.45'}",
+			expected: 1,
+		},
+		{
+			name:     "index",
+			builder:  Type("provider").Label("aws").Index(1),
+			test:     "provider:aws[1]",
+			expected: 1,
+		},
+		{
+			name:     "root attribute",
+			builder:  Root().Where(Attr("region")).Attribute("region"),
+			test:     ".{region}/@region",
+			expected: -1,
+		},
+		{
+			name:     "into module",
+			builder:  Type("module").Label("app").Into("resource"),
+			test:     "module:app/>>resource",
+			expected: -1,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			built, err := tc.builder.Expr()
+			if err != nil {
+				t.Fatalf("failed to build: %v", err)
+			}
+			parsed, err := parse.NewParser(strings.NewReader(tc.test)).Parse()
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !parse.Equal(built, parsed) {
+				t.Fatalf("Expected '%v' but found '%v'", parsed.Print(), built.Print())
+			}
+			if tc.expected < 0 {
+				return
+			}
+			compilation, err := tc.builder.Compile()
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			blocks, err := compilation.Exec(root)
+			if err != nil {
+				t.Fatalf("failed to find block: %v", err)
+			}
+			if len(blocks) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, len(blocks))
+			}
+		})
+	}
+
+	t.Run("values_with_quotes", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"main.tf": {Data: []byte(`
+locals {
+  quoted = "it's \"quoted\""
+}
+`)},
+		}
+		compilation, err := Type("locals").Where(Attr("quoted").Eq(cty.StringVal(`it's "quoted"`))).Compile()
+		if err != nil {
+			t.Fatalf("failed to compile: %v", err)
+		}
+		hclFile, diags := hclparse.NewParser().ParseHCL(fsys["main.tf"].Data, "main.tf")
+		if diags.HasErrors() {
+			t.Fatalf("failed to parse file: %v", diags)
+		}
+		blocks, err := compilation.Exec(Nodes{NewNode(hclFile.Body)})
+		if err != nil {
+			t.Fatalf("failed to find block: %v", err)
+		}
+		if len(blocks) != 1 {
+			t.Errorf("Expected '1' but found '%v'", len(blocks))
+		}
+	})
+
+	t.Run("builders_are_immutable", func(t *testing.T) {
+		base := Type("provider").Label("aws")
+		base.Child("assume_role")
+		if base.String() != "provider:aws" {
+			t.Errorf("Expected 'provider:aws' but found '%v'", base.String())
+		}
+	})
+
+	errs := []struct {
+		name    string
+		builder *Builder
+	}{
+		{
+			name:    "unsupported value type",
+			builder: Type("terraform").Where(Attr("encrypt").Eq(cty.True)),
+		},
+		{
+			name:    "null value",
+			builder: Type("terraform").Where(Attr("encrypt").Eq(cty.NullVal(cty.String))),
+		},
+		{
+			name:    "two values",
+			builder: Type("terraform").Where(Attr("a").Eq(cty.StringVal("a")).Eq(cty.StringVal("b"))),
+		},
+	}
+	for _, tc := range errs {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			if _, err := tc.builder.Child("x").Compile(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+const editSource = `# Providers
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.11.0"
+    }
+  }
+}
+
+provider "aws" {
+  region = "eu-central-1" # the default
+}
+
+provider "aws" {
+  alias  = "infra-account"
+  region = "eu-central-1"
+}
+`
+
+func parseWriteFile(t *testing.T, src string) *hclwrite.File {
+	t.Helper()
+	f, diags := hclwrite.ParseConfig([]byte(src), "main.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse file: %v", diags)
+	}
+	return f
+}
+
+func TestSet(t *testing.T) {
+	cases := []struct {
+		name     string
+		test     string
+		attr     string
+		value    cty.Value
+		expr     string
+		count    int
+		expected string
+	}{
+		{
+			name:  "existing attribute",
+			test:  "provider:aws",
+			attr:  "region",
+			value: cty.StringVal("eu-west-1"),
+			count: 2,
+			expected: strings.ReplaceAll(editSource,
+				`region = "eu-central-1"`, `region = "eu-west-1"`),
+		},
+		{
+			name:  "new attribute",
+			test:  "provider:aws{alias='infra-account'}",
+			attr:  "profile",
+			value: cty.StringVal("infra"),
+			count: 1,
+			expected: strings.Replace(editSource,
+				"  alias  = \"infra-account\"\n  region = \"eu-central-1\"\n}\n",
+				"  alias   = \"infra-account\"\n  region  = \"eu-central-1\"\n  profile = \"infra\"\n}\n", 1),
+		},
+		{
+			name:  "expression",
+			test:  "terraform/required_providers",
+			attr:  "aws",
+			expr:  `{ source = "hashicorp/aws", version = ">= 5.20" }`,
+			count: 1,
+			expected: strings.Replace(editSource, `{
+      source  = "hashicorp/aws"
+      version = ">= 5.11.0"
+    }`, `{ source = "hashicorp/aws", version = ">= 5.20" }`, 1),
+		},
+		{
+			name:  "expression referring to a variable",
+			test:  "provider:aws[0]",
+			attr:  "region",
+			expr:  "var.region",
+			count: 1,
+			expected: strings.Replace(editSource,
+				`region = "eu-central-1" # the default`, `region = var.region # the default`, 1),
+		},
+		{
+			name:  "nested key",
+			test:  "terraform/required_providers",
+			attr:  "aws.version",
+			expr:  `">= 5.20"`,
+			count: 1,
+			expected: strings.Replace(editSource,
+				`version = ">= 5.11.0"`, `version = ">= 5.20"`, 1),
+		},
+		{
+			name:  "new nested key",
+			test:  "terraform/required_providers",
+			attr:  "aws.configuration_aliases",
+			expr:  "[aws.infra]",
+			count: 1,
+			expected: strings.Replace(editSource, `      source  = "hashicorp/aws"
+      version = ">= 5.11.0"
+`, `      source                = "hashicorp/aws"
+      version               = ">= 5.11.0"
+      configuration_aliases = [aws.infra]
+`, 1),
+		},
+		{
+			name:  "root attribute",
+			test:  ".",
+			attr:  "region",
+			value: cty.StringVal("eu-west-1"),
+			count: 1,
+			expected: editSource + `region = "eu-west-1"
+`,
+		},
+		{
+			name:     "no match",
+			test:     "provider:google",
+			attr:     "region",
+			value:    cty.StringVal("eu-west-1"),
+			count:    0,
+			expected: editSource,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, editSource)
+			var count int
+			var err error
+			if tc.expr != "" {
+				count, err = SetExpr(f, tc.test, tc.attr, tc.expr)
+			} else {
+				count, err = Set(f, tc.test, tc.attr, tc.value)
+			}
+			if err != nil {
+				t.Fatalf("failed to set attribute: %v", err)
+			}
+			if count != tc.count {
+				t.Errorf("Expected '%v' but found '%v'", tc.count, count)
+			}
+			if string(f.Bytes()) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, string(f.Bytes()))
+			}
+		})
+	}
+
+	errs := []struct {
+		name string
+		test string
+		attr string
+		expr string
+	}{
+		{
+			name: "invalid query",
+			test: "provider:",
+			attr: "region",
+			expr: `"x"`,
+		},
+		{
+			name: "invalid attribute name",
+			test: "provider",
+			attr: "aws..version",
+			expr: `"x"`,
+		},
+		{
+			name: "invalid expression",
+			test: "provider",
+			attr: "region",
+			expr: `"x`,
+		},
+		{
+			name: "missing attribute on the path",
+			test: "terraform/required_providers",
+			attr: "google.version",
+			expr: `"x"`,
+		},
+		{
+			name: "missing key on the path",
+			test: "terraform/required_providers",
+			attr: "aws.config.version",
+			expr: `"x"`,
+		},
+		{
+			name: "path through a value that is not an object",
+			test: "terraform/required_providers",
+			attr: "aws.version.minimum",
+			expr: `"x"`,
+		},
+		{
+			name: "attribute match",
+			test: "provider/@region",
+			attr: "region",
+			expr: `"x"`,
+		},
+	}
+	for _, tc := range errs {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, editSource)
+			if _, err := SetExpr(f, tc.test, tc.attr, tc.expr); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if string(f.Bytes()) != editSource {
+				t.Errorf("Expected the file to be left untouched, but found '%v'", string(f.Bytes()))
+			}
+		})
+	}
+
+	t.Run("invalid_result", func(t *testing.T) {
+		const oneLine = "a { x = 1 }\n"
+		f := parseWriteFile(t, oneLine)
+		if _, err := Set(f, "a", "y", cty.NumberIntVal(2)); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if string(Bytes(f)) != oneLine {
+			t.Errorf("Expected the file to be left untouched, but found '%v'", string(Bytes(f)))
+		}
+	})
+}
+
+func TestRemove(t *testing.T) {
+	cases := []struct {
+		name     string
+		test     string
+		removed  []string
+		expected string
+	}{
+		{
+			name:    "blocks",
+			test:    "provider:aws{alias='infra-account'}",
+			removed: []string{"provider"},
+			expected: strings.Replace(editSource, `provider "aws" {
+  alias  = "infra-account"
+  region = "eu-central-1"
+}
+`, "", 1),
+		},
+		{
+			name:     "block with leading comment",
+			test:     "terraform",
+			removed:  []string{"terraform"},
+			expected: editSource[strings.Index(editSource, "\nprovider"):],
+		},
+		{
+			name:    "nested block",
+			test:    "terraform/required_providers",
+			removed: []string{"required_providers"},
+			expected: strings.Replace(editSource, `  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.11.0"
+    }
+  }
+`, "", 1),
+		},
+		{
+			name:    "attributes",
+			test:    "provider:aws/@alias",
+			removed: []string{"@alias"},
+			expected: strings.Replace(editSource, `  alias  = "infra-account"
+  region = "eu-central-1"`, `  region = "eu-central-1"`, 1),
+		},
+		{
+			name:    "attributes with comments",
+			test:    "provider/@region",
+			removed: []string{"@region", "@region"},
+			expected: strings.Replace(strings.Replace(editSource,
+				"  region = \"eu-central-1\" # the default\n", "", 1),
+				"  alias  = \"infra-account\"\n  region = \"eu-central-1\"\n", "  alias = \"infra-account\"\n", 1),
+		},
+		{
+			name:     "no match",
+			test:     "backend",
+			removed:  []string{},
+			expected: editSource,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, editSource)
+			removed, err := Remove(f, tc.test)
+			if err != nil {
+				t.Fatalf("failed to remove: %v", err)
+			}
+			if len(removed) != len(tc.removed) {
+				t.Fatalf("Expected '%v' but found '%v'", len(tc.removed), len(removed))
+			}
+			for i, n := range removed {
+				if n.Type() != tc.removed[i] {
+					t.Errorf("Expected '%v' but found '%v'", tc.removed[i], n.Type())
+				}
+			}
+			if string(f.Bytes()) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, string(f.Bytes()))
+			}
+		})
+	}
+
+	t.Run("root", func(t *testing.T) {
+		f := parseWriteFile(t, editSource)
+		if _, err := Remove(f, "."); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if string(f.Bytes()) != editSource {
+			t.Errorf("Expected the file to be left untouched, but found '%v'", string(f.Bytes()))
+		}
+	})
+}
+
+func TestInsert(t *testing.T) {
+	cases := []struct {
+		name     string
+		test     string
+		pos      Position
+		src      string
+		count    int
+		expected string
+	}{
+		{
+			name:  "child block",
+			test:  "provider:aws[0]",
+			pos:   Inside,
+			src:   "assume_role {\nrole_arn = \"arn\"\n}",
+			count: 1,
+			expected: strings.Replace(editSource, `  region = "eu-central-1" # the default
+}`, `  region = "eu-central-1" # the default
+  assume_role {
+    role_arn = "arn"
+  }
+}`, 1),
+		},
+		{
+			name:  "child attribute",
+			test:  "provider:aws",
+			pos:   Inside,
+			src:   `profile = "default"`,
+			count: 2,
+			expected: strings.Replace(strings.Replace(editSource,
+				"  region = \"eu-central-1\" # the default\n",
+				"  region  = \"eu-central-1\" # the default\n  profile = \"default\"\n", 1),
+				"  alias  = \"infra-account\"\n  region = \"eu-central-1\"\n",
+				"  alias   = \"infra-account\"\n  region  = \"eu-central-1\"\n  profile = \"default\"\n", 1),
+		},
+		{
+			name:     "root attribute",
+			test:     ".",
+			pos:      Inside,
+			src:      `region = "eu-west-1"`,
+			count:    1,
+			expected: editSource + "\nregion = \"eu-west-1\"\n",
+		},
+		{
+			name:     "block before a commented block",
+			test:     "terraform",
+			pos:      Before,
+			src:      `locals {}`,
+			count:    1,
+			expected: "locals {}\n\n" + editSource,
+		},
+		{
+			name:     "block after a block",
+			test:     "provider:aws{alias}",
+			pos:      After,
+			src:      `provider "google" {}`,
+			count:    1,
+			expected: editSource + "\nprovider \"google\" {}\n",
+		},
+		{
+			name:  "attribute after a commented attribute",
+			test:  "provider:aws[0]/@region",
+			pos:   After,
+			src:   `alias = "default"`,
+			count: 1,
+			expected: strings.Replace(editSource,
+				"  region = \"eu-central-1\" # the default\n",
+				"  region = \"eu-central-1\" # the default\n  alias  = \"default\"\n", 1),
+		},
+		{
+			name:  "attribute before an attribute",
+			test:  "provider:aws{alias}/@alias",
+			pos:   Before,
+			src:   `profile = "infra"`,
+			count: 1,
+			expected: strings.Replace(editSource,
+				"  alias  = \"infra-account\"\n  region = \"eu-central-1\"\n",
+				"  profile = \"infra\"\n  alias   = \"infra-account\"\n  region  = \"eu-central-1\"\n", 1),
+		},
+		{
+			name:     "no match",
+			test:     "backend",
+			pos:      Inside,
+			src:      `bucket = "x"`,
+			count:    0,
+			expected: editSource,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, editSource)
+			count, err := Insert(f, tc.test, tc.pos, tc.src)
+			if err != nil {
+				t.Fatalf("failed to insert: %v", err)
+			}
+			if count != tc.count {
+				t.Errorf("Expected '%v' but found '%v'", tc.count, count)
+			}
+			if string(f.Bytes()) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, string(f.Bytes()))
+			}
+		})
+	}
+
+	t.Run("block", func(t *testing.T) {
+		block := hclwrite.NewBlock("assume_role", nil)
+		block.Body().SetAttributeValue("role_arn", cty.StringVal("arn"))
+		f := parseWriteFile(t, "provider \"aws\" {}\n")
+		if _, err := InsertBlock(f, "provider:aws", Inside, block); err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		expected := "provider \"aws\" {\n  assume_role {\n    role_arn = \"arn\"\n  }\n}\n"
+		if string(f.Bytes()) != expected {
+			t.Errorf("Expected '%v' but found '%v'", expected, string(f.Bytes()))
+		}
+	})
+
+	t.Run("if_missing", func(t *testing.T) {
+		src, err := os.ReadFile("test_cases/test-1.tf")
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		f := parseWriteFile(t, string(src))
+		count, err := Insert(f, "provider:aws", Inside, "assume_role {\n  role_arn = \"arn\"\n}", IfMissing())
+		if err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("Expected '%v' but found '%v'", 1, count)
+		}
+		expected := strings.Replace(string(src),
+			"  region = \"eu-central-1\"\n}\n",
+			"  region = \"eu-central-1\"\n  assume_role {\n    role_arn = \"arn\"\n  }\n}\n", 1)
+		if string(f.Bytes()) != expected {
+			t.Errorf("Expected '%v' but found '%v'", expected, string(f.Bytes()))
+		}
+	})
+
+	errs := []struct {
+		name string
+		test string
+		pos  Position
+		src  string
+	}{
+		{
+			name: "invalid content",
+			test: "provider",
+			pos:  Inside,
+			src:  "assume_role {",
+		},
+		{
+			name: "attribute defined twice",
+			test: "provider",
+			pos:  Inside,
+			src:  `region = "eu-west-1"`,
+		},
+		{
+			name: "inside an attribute",
+			test: "provider/@region",
+			pos:  Inside,
+			src:  `region = "eu-west-1"`,
+		},
+		{
+			name: "next to the root",
+			test: ".",
+			pos:  After,
+			src:  `region = "eu-west-1"`,
+		},
+	}
+	for _, tc := range errs {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, editSource)
+			if _, err := Insert(f, tc.test, tc.pos, tc.src); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if string(f.Bytes()) != editSource {
+				t.Errorf("Expected the file to be left untouched, but found '%v'", string(f.Bytes()))
+			}
+		})
+	}
+
+	const oneLine = "provider \"aws\" { region = \"x\" }\n"
+	for name, pos := range map[string]Position{"before": Before, "after": After} {
+		t.Run(name+"_an_attribute_of_a_single_line_block", func(t *testing.T) {
+			f := parseWriteFile(t, oneLine)
+			if _, err := Insert(f, "provider/@region", pos, `alias = "y"`); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if string(Bytes(f)) != oneLine {
+				t.Errorf("Expected the file to be left untouched, but found '%v'", string(Bytes(f)))
+			}
+		})
+	}
+}
+
+const renameSource = `module "bruno-beans-7132aaa" {
+  source = "./modules/beans"
+
+  providers = {
+    aws = aws.infra
+  }
+}
+
+provider "aws" {
+  alias = "infra"
+}
+
+resource "aws_s3_bucket" "logs" {
+  provider = aws.infra
+  bucket   = "logs-${module.bruno-beans-7132aaa.suffix}"
+}
+
+output "beans" {
+  value = module.bruno-beans-7132aaa.id
+}
+`
+
+func TestRename(t *testing.T) {
+	other := `locals {
+  id = module.bruno-beans-7132aaa.id
+}
+`
+	cases := []struct {
+		name     string
+		rename   func(f *hclwrite.File, refs *hclwrite.File) (int, error)
+		count    int
+		expected string
+		other    string
+	}{
+		{
+			name: "label",
+			rename: func(f *hclwrite.File, _ *hclwrite.File) (int, error) {
+				return RenameLabel(f, "module", 0, "bruno-beans-8243bbb")
+			},
+			count:    1,
+			expected: strings.Replace(renameSource, `module "bruno-beans-7132aaa"`, `module "bruno-beans-8243bbb"`, 1),
+			other:    other,
+		},
+		{
+			name: "label and references",
+			rename: func(f *hclwrite.File, refs *hclwrite.File) (int, error) {
+				return RenameLabel(f, "module", 0, "bruno-beans-8243bbb", WithReferences(refs))
+			},
+			count:    1,
+			expected: strings.ReplaceAll(renameSource, "bruno-beans-7132aaa", "bruno-beans-8243bbb"),
+			other:    strings.ReplaceAll(other, "bruno-beans-7132aaa", "bruno-beans-8243bbb"),
+		},
+		{
+			name: "provider and references",
+			rename: func(f *hclwrite.File, refs *hclwrite.File) (int, error) {
+				return RenameLabel(f, "provider{alias='infra'}", 0, "aws2", WithReferences(refs))
+			},
+			count:    1,
+			expected: strings.ReplaceAll(strings.Replace(renameSource, `provider "aws"`, `provider "aws2"`, 1), "aws.infra", "aws2.infra"),
+			other:    other,
+		},
+		{
+			name: "alias",
+			rename: func(f *hclwrite.File, _ *hclwrite.File) (int, error) {
+				return RenameAlias(f, "provider:aws", "infra2")
+			},
+			count:    1,
+			expected: strings.Replace(renameSource, `alias = "infra"`, `alias = "infra2"`, 1),
+			other:    other,
+		},
+		{
+			name: "alias and references",
+			rename: func(f *hclwrite.File, refs *hclwrite.File) (int, error) {
+				return RenameAlias(f, "provider:aws", "infra2", WithReferences(refs))
+			},
+			count: 1,
+			expected: strings.ReplaceAll(strings.Replace(renameSource,
+				`alias = "infra"`, `alias = "infra2"`, 1), "aws.infra", "aws.infra2"),
+			other: other,
+		},
+		{
+			name: "second label",
+			rename: func(f *hclwrite.File, refs *hclwrite.File) (int, error) {
+				return RenameLabel(f, "resource", 1, "access_logs", WithReferences(refs))
+			},
+			count:    1,
+			expected: strings.Replace(renameSource, `"logs" {`, `"access_logs" {`, 1),
+			other:    other,
+		},
+		{
+			name: "type",
+			rename: func(f *hclwrite.File, _ *hclwrite.File) (int, error) {
+				return RenameType(f, "output", "value")
+			},
+			count:    1,
+			expected: strings.Replace(renameSource, `output "beans"`, `value "beans"`, 1),
+			other:    other,
+		},
+		{
+			name: "no match",
+			rename: func(f *hclwrite.File, _ *hclwrite.File) (int, error) {
+				return RenameLabel(f, "variable", 0, "x")
+			},
+			count:    0,
+			expected: renameSource,
+			other:    other,
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, renameSource)
+			refs := parseWriteFile(t, other)
+			count, err := tc.rename(f, refs)
+			if err != nil {
+				t.Fatalf("failed to rename: %v", err)
+			}
+			if count != tc.count {
+				t.Errorf("Expected '%v' but found '%v'", tc.count, count)
+			}
+			if string(f.Bytes()) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, string(f.Bytes()))
+			}
+			if string(refs.Bytes()) != tc.other {
+				t.Errorf("Expected '%v' but found '%v'", tc.other, string(refs.Bytes()))
+			}
+		})
+	}
+
+	errs := []struct {
+		name   string
+		rename func(f *hclwrite.File) (int, error)
+	}{
+		{
+			name: "missing label",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameLabel(f, "resource", 2, "x")
+			},
+		},
+		{
+			name: "label that cannot be referred to",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameLabel(f, "module", 0, "a.b", WithReferences())
+			},
+		},
+		{
+			name: "alias of a block that is not a provider",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameAlias(f, "module", "x")
+			},
+		},
+		{
+			name: "invalid alias",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameAlias(f, "provider", "a.b")
+			},
+		},
+		{
+			name: "invalid type",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameType(f, "output", "a b")
+			},
+		},
+		{
+			name: "attribute",
+			rename: func(f *hclwrite.File) (int, error) {
+				return RenameType(f, "output/@value", "x")
+			},
+		},
+	}
+	for _, tc := range errs {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, renameSource)
+			if _, err := tc.rename(f); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if string(f.Bytes()) != renameSource {
+				t.Errorf("Expected the file to be left untouched, but found '%v'", string(f.Bytes()))
+			}
+		})
+	}
+
+	t.Run("alias_of_a_default_provider", func(t *testing.T) {
+		src := `provider "aws" {
+  region = "eu-west-1"
+}
+
+resource "aws_s3_bucket" "logs" {
+  provider = aws
+}
+
+resource "aws_s3_bucket" "data" {
+  provider = aws.infra
+}
+
+module "beans" {
+  providers = {
+    aws = aws
+  }
+}
+`
+		f := parseWriteFile(t, src)
+		count, err := RenameAlias(f, "provider:aws", "west", WithReferences())
+		if err != nil {
+			t.Fatalf("failed to rename: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("Expected '%v' but found '%v'", 1, count)
+		}
+		expected := `provider "aws" {
+  region = "eu-west-1"
+  alias  = "west"
+}
+
+resource "aws_s3_bucket" "logs" {
+  provider = aws.west
+}
+
+resource "aws_s3_bucket" "data" {
+  provider = aws.infra
+}
+
+module "beans" {
+  providers = {
+    aws = aws.west
+  }
+}
+`
+		if string(Bytes(f)) != expected {
+			t.Errorf("Expected '%v' but found '%v'", expected, string(Bytes(f)))
+		}
+	})
+}
+
+// looseSource is not formatted, which edits should leave alone outside of
+// the lines they change.
+const looseSource = `locals { a    = 1 }
+
+variable "region" {}
+
+provider "aws" {
+    region   = "x"  # the default
+    alias="a"
+}
+
+output "o" {
+  value=var.region
+}
+`
+
+func TestKeepFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		edit     func(f *hclwrite.File) error
+		expected string
+	}{
+		{
+			name: "set",
+			edit: func(f *hclwrite.File) error {
+				_, err := Set(f, "provider", "region", cty.StringVal("y"))
+				return err
+			},
+			expected: strings.Replace(looseSource,
+				`    region   = "x"  # the default`, `  region = "y" # the default`, 1),
+		},
+		{
+			name: "remove",
+			edit: func(f *hclwrite.File) error {
+				_, err := Remove(f, "provider/@alias")
+				return err
+			},
+			expected: strings.Replace(looseSource, "    alias=\"a\"\n", "", 1),
+		},
+		{
+			name: "insert",
+			edit: func(f *hclwrite.File) error {
+				_, err := Insert(f, "locals", After, `variable "zone" {}`)
+				return err
+			},
+			expected: strings.Replace(looseSource, "locals { a    = 1 }\n",
+				"locals { a    = 1 }\n\nvariable \"zone\" {}\n", 1),
+		},
+		{
+			name: "rename with references",
+			edit: func(f *hclwrite.File) error {
+				_, err := RenameLabel(f, "variable", 0, "zone", WithReferences())
+				return err
+			},
+			expected: strings.Replace(strings.Replace(looseSource,
+				`variable "region"`, `variable "zone"`, 1),
+				`value=var.region`, `value = var.zone`, 1),
+		},
+		{
+			name: "rename type",
+			edit: func(f *hclwrite.File) error {
+				_, err := RenameType(f, "output", "value")
+				return err
+			},
+			expected: strings.Replace(looseSource, `output "o"`, `value "o"`, 1),
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			f := parseWriteFile(t, looseSource)
+			if err := tc.edit(f); err != nil {
+				t.Fatalf("failed to edit file: %v", err)
+			}
+			if string(Bytes(f)) != tc.expected {
+				t.Errorf("Expected '%v' but found '%v'", tc.expected, string(Bytes(f)))
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	files := map[string]*hclwrite.File{
+		"main.tf":      parseWriteFile(t, editSource),
+		"variables.tf": parseWriteFile(t, "variable \"region\" {}\n"),
+	}
+
+	diffs, err := DryRun(files, func(f *hclwrite.File) error {
+		_, err := Set(f, "provider:aws{alias}", "region", cty.StringVal("eu-west-1"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	expected := []FileDiff{{
+		Name: "main.tf",
+		Diff: `--- a/main.tf
++++ b/main.tf
+@@ -14,5 +14,5 @@
+ 
+ provider "aws" {
+   alias  = "infra-account"
+-  region = "eu-central-1"
++  region = "eu-west-1"
+ }
+`,
+	}}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Expected '%v' but found '%v'", expected, diffs)
+	}
+	if string(files["main.tf"].Bytes()) != editSource {
+		t.Errorf("Expected the file to be left untouched, but found '%v'", string(files["main.tf"].Bytes()))
+	}
+
+	t.Run("several_files", func(t *testing.T) {
+		diffs, err := DryRun(files, func(f *hclwrite.File) error {
+			_, err := Insert(f, ".", Inside, `locals {}`)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to run: %v", err)
+		}
+		if len(diffs) != 2 || diffs[0].Name != "main.tf" || diffs[1].Name != "variables.tf" {
+			t.Errorf("Expected diffs of 'main.tf' and 'variables.tf' but found '%v'", diffs)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := DryRun(files, func(f *hclwrite.File) error {
+			_, err := Remove(f, ".")
+			return err
+		})
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+	})
+}
@@ -39,12 +39,36 @@ func TestMain(t *testing.T) {
 			tk:       IDENT,
 			expected: 1,
 		},
+		{
+			name:     "IDENT with unicode letters",
+			fixture:  "tâche_été",
+			tk:       IDENT,
+			expected: 1,
+		},
 		{
 			name:     "NEST",
 			fixture:  "/",
 			tk:       NEST,
 			expected: 1,
 		},
+		{
+			name:     "INTO",
+			fixture:  "/>>",
+			tk:       INTO,
+			expected: 1,
+		},
+		{
+			name:     "PROJECT",
+			fixture:  "/@",
+			tk:       PROJECT,
+			expected: 1,
+		},
+		{
+			name:     "ROOT",
+			fixture:  ".",
+			tk:       ROOT,
+			expected: 1,
+		},
 		{
 			name:     "FILTER_START",
 			fixture:  "{",
@@ -149,3 +173,114 @@ func testForToken(tokens map[string]Token, expected Token, lt string) error {
 
 	return err
 }
+
+func TestLiteral(t *testing.T) {
+	cases := []struct {
+		name     string
+		fixture  string
+		expected string
+	}{
+		{
+			name:     "single quotes",
+			fixture:  `'some "thing"'`,
+			expected: `some "thing"`,
+		},
+		{
+			name:     "double quotes",
+			fixture:  `"some 'thing'"`,
+			expected: `some 'thing'`,
+		},
+		{
+			name:     "escaped quote",
+			fixture:  `"say \"hi\""`,
+			expected: `say "hi"`,
+		},
+		{
+			name:     "escaped single quote",
+			fixture:  `'it\'s'`,
+			expected: `it's`,
+		},
+		{
+			name:     "escaped backslash",
+			fixture:  `'a\\b'`,
+			expected: `a\b`,
+		},
+		{
+			name:     "escaped new line",
+			fixture:  `'a\nb'`,
+			expected: "a\nb",
+		},
+		{
+			name:     "escaped code point",
+			fixture:  `'café \U0001F600'`,
+			expected: "café 😀",
+		},
+		{
+			name:     "json value",
+			fixture:  `'[{\"name\":\"web\"}]'`,
+			expected: `[{"name":"web"}]`,
+		},
+	}
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			s := NewScanner(strings.NewReader(tc.fixture))
+			tk, lt := s.Scan()
+			if tk != LITERAL {
+				t.Fatalf("Expected token of type 'LITERAL', but found %v: %v", tk, s.Err())
+			}
+			if lt != tc.expected {
+				t.Fatalf("Expected '%v' but found '%v'", tc.expected, lt)
+			}
+			if tk, _ := s.Scan(); tk != EOF {
+				t.Fatalf("Expected token of type 'EOF', but found %v", tk)
+			}
+		})
+	}
+}
+
+func TestIllegalLiteral(t *testing.T) {
+	cases := []struct {
+		name    string
+		fixture string
+	}{
+		{
+			name:    "unterminated",
+			fixture: `'some`,
+		},
+		{
+			name:    "unterminated after escape",
+			fixture: `'some\'`,
+		},
+		{
+			name:    "dangling escape",
+			fixture: `'some\`,
+		},
+		{
+			name:    "unknown escape",
+			fixture: `'\q'`,
+		},
+		{
+			name:    "short code point",
+			fixture: `'\u00'`,
+		},
+		{
+			name:    "surrogate code point",
+			fixture: `'\ud800'`,
+		},
+	}
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			s := NewScanner(strings.NewReader(tc.fixture))
+			if tk, _ := s.Scan(); tk != ILLEGAL {
+				t.Fatalf("Expected token of type 'ILLEGAL', but found %v", tk)
+			}
+			if s.Err() == nil {
+				t.Fatal("Expected an error, but found none")
+			}
+		})
+	}
+}
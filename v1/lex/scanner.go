@@ -3,11 +3,14 @@ package lex
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"strconv"
 )
 
 type Scanner struct {
-	r *bufio.Reader
+	r   *bufio.Reader
+	err error
 }
 
 func NewScanner(r io.Reader) *Scanner {
@@ -60,21 +63,97 @@ func (s *Scanner) scanIdent() (tk Token, lt string) {
 	return IDENT, buf.String()
 }
 
+// Err returns the reason of the last ILLEGAL token, when there is more to it
+// than the token itself.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+func (s *Scanner) illegal(lt string, err error) (tk Token, _ string) {
+	s.err = err
+	return ILLEGAL, lt
+}
+
+// scanLiteral reads a quoted literal, resolving the escape sequences of HCL
+// strings along with an escaped single quote.
 func (s *Scanner) scanLiteral() (tk Token, lt string) {
 	var buf bytes.Buffer
 	startQuote := s.read()
 	for {
-		if ch := s.read(); ch == startQuote || ch == eof {
-			break
-		} else {
+		ch := s.read()
+		switch ch {
+		case startQuote:
+			return LITERAL, buf.String()
+		case eof:
+			return s.illegal(buf.String(), fmt.Errorf("unterminated literal %c%v", startQuote, buf.String()))
+		case '\\':
+			esc, err := s.scanEscape()
+			if err != nil {
+				return s.illegal(buf.String(), err)
+			}
+			buf.WriteRune(esc)
+		default:
 			buf.WriteRune(ch)
 		}
 	}
+}
+
+func (s *Scanner) scanEscape() (rune, error) {
+	ch := s.read()
+	switch ch {
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case '"', '\'', '\\':
+		return ch, nil
+	case 'u':
+		return s.scanCodePoint(4)
+	case 'U':
+		return s.scanCodePoint(8)
+	case eof:
+		return 0, fmt.Errorf("unterminated escape sequence")
+	}
+	return 0, fmt.Errorf("invalid escape sequence '\\%c'", ch)
+}
+
+func (s *Scanner) scanCodePoint(digits int) (rune, error) {
+	var buf bytes.Buffer
+	for range digits {
+		ch := s.read()
+		if ch == eof {
+			return 0, fmt.Errorf("unterminated escape sequence")
+		}
+		buf.WriteRune(ch)
+	}
+	code, err := strconv.ParseUint(buf.String(), 16, 32)
+	if err != nil || code > 0x10ffff || (code >= 0xd800 && code <= 0xdfff) {
+		return 0, fmt.Errorf("invalid code point '%v'", buf.String())
+	}
+	return rune(code), nil
+}
 
-	return LITERAL, buf.String()
+func (s *Scanner) scanNest() (tk Token, lt string) {
+	s.read()
+	ch := s.read()
+	if ch == '@' {
+		return PROJECT, "/@"
+	}
+	if ch != '>' {
+		s.unread()
+		return NEST, "/"
+	}
+	if ch := s.read(); ch != '>' {
+		s.unread()
+		return ILLEGAL, "/>"
+	}
+	return INTO, "/>>"
 }
 
 func (s *Scanner) Scan() (tk Token, lt string) {
+	s.err = nil
 	ch := s.read()
 
 	if isWhiteSpace(ch) {
@@ -88,7 +167,10 @@ func (s *Scanner) Scan() (tk Token, lt string) {
 	case eof:
 		return EOF, ""
 	case '/':
-		return NEST, string(ch)
+		s.unread()
+		return s.scanNest()
+	case '.':
+		return ROOT, string(ch)
 	case ':':
 		return NAMED, string(ch)
 	case '[':
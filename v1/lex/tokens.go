@@ -11,6 +11,9 @@ const (
 	SELECT_END   Token = "]"
 	NAMED        Token = ":"
 	NEST         Token = "/"
+	INTO         Token = "/>>"
+	PROJECT      Token = "/@"
+	ROOT         Token = "."
 	FILTER_START Token = "{"
 	FILTER_END   Token = "}"
 	EQUAL        Token = "="
@@ -23,6 +26,8 @@ func (t Token) IsOperator() bool {
 	return t == SELECT_START ||
 		t == NAMED ||
 		t == NEST ||
+		t == INTO ||
+		t == PROJECT ||
 		t == FILTER_START ||
 		t == EQUAL
 }
@@ -1,15 +1,32 @@
 package lex
 
+import "unicode"
+
 const eof rune = rune(0)
 
 func isWhiteSpace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n'
 }
 
+// isLegalIdent follows the identifier characters of HCL: Unicode letters,
+// digits and combining marks, along with '-' and '_'.
 func isLegalIdent(ch rune) bool {
-	return (ch >= 'a' && ch <= 'z') ||
-		(ch >= 'A' && ch <= 'Z') ||
-		(ch >= '0' && ch <= '9') ||
+	return unicode.IsLetter(ch) ||
+		unicode.IsDigit(ch) ||
+		unicode.In(ch, unicode.Mn, unicode.Mc) ||
 		ch == '-' ||
 		ch == '_'
 }
+
+// IsIdent reports whether str can be scanned as a single identifier.
+func IsIdent(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, ch := range str {
+		if !isLegalIdent(ch) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package hclpath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ErrLimitExceeded is matched, through errors.Is, by the errors returned when
+// an execution goes over one of its Limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bounds the work done by a single execution of a compilation. A zero
+// value means no limit.
+type Limits struct {
+	// MaxResults is the largest number of matches an execution may yield.
+	MaxResults int
+	// MaxDepth is the deepest level of nesting an execution may descend to,
+	// top level blocks being at depth 1.
+	MaxDepth int
+	// MaxVisited is the largest number of blocks an execution may visit.
+	MaxVisited int
+	// Timeout is the longest an execution may run for. Going over it fails
+	// with a LimitError which also matches context.DeadlineExceeded.
+	Timeout time.Duration
+}
+
+// LimitError reports which of the Limits an execution went over.
+type LimitError struct {
+	Limit string
+	// Max is zero for the timeout.
+	Max int
+	// Err is the error that stopped the execution, context.DeadlineExceeded
+	// for the timeout, or nil.
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v: %v", ErrLimitExceeded, e.Limit, e.Err)
+	}
+	return fmt.Sprintf("%v: more than %v %v", ErrLimitExceeded, e.Max, e.Limit)
+}
+
+func (e *LimitError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{ErrLimitExceeded, e.Err}
+	}
+	return []error{ErrLimitExceeded}
+}
+
+// run holds the state of a single execution of a compilation, so that
+// compilations themselves carry no mutable state.
+type run struct {
+	ctx      context.Context
+	limits   Limits
+	mode     Mode
+	visited  int
+	warnings hcl.Diagnostics
+	traces   map[*evaluation]*Trace
+	// candidates and steps gather, in order, the names met by steps while
+	// they had yet to match anything.
+	candidates map[*evaluation]*candidates
+	steps      []*evaluation
+}
+
+// stopped returns why the context of the execution is done, the LimitError
+// when its Timeout is over, or nil while it is not done.
+func (r *run) stopped() error {
+	if r.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(r.ctx)
+}
+
+func (r *run) visit(b item) error {
+	if err := r.stopped(); err != nil {
+		return err
+	}
+	r.visited++
+	if r.limits.MaxVisited > 0 && r.visited > r.limits.MaxVisited {
+		return &LimitError{Limit: "visited blocks", Max: r.limits.MaxVisited}
+	}
+	if r.limits.MaxDepth > 0 && b.depth > r.limits.MaxDepth {
+		return &LimitError{Limit: "levels of nesting", Max: r.limits.MaxDepth}
+	}
+	return nil
+}
+
+// anomaly fails the execution with err in strict mode. In lenient mode, err is
+// recorded as warnings and nil is returned.
+func (r *run) anomaly(err error) error {
+	if r.mode != Lenient {
+		return err
+	}
+	var diags hcl.Diagnostics
+	if !errors.As(err, &diags) {
+		diags = hcl.Diagnostics{{Summary: err.Error()}}
+	}
+	for _, d := range diags {
+		warning := *d
+		warning.Severity = hcl.DiagWarning
+		r.warnings = append(r.warnings, &warning)
+	}
+	return nil
+}
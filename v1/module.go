@@ -0,0 +1,163 @@
+package hclpath
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// moduleLoader reads Terraform module directories out of a file system. All
+// the modules of a query share the same parser.
+type moduleLoader struct {
+	fsys   fs.FS
+	parser *hclparse.Parser
+	logger *slog.Logger
+}
+
+func (l *moduleLoader) load(dir string) (hcl.Body, error) {
+	entries, err := fs.ReadDir(l.fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module '%v': %v", dir, err)
+	}
+	var files []*hcl.File
+	for _, e := range entries {
+		if e.IsDir() || !isModuleFile(e.Name()) {
+			continue
+		}
+		hclFile, err := parseFSFile(l.parser, l.fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, hclFile)
+	}
+	return hcl.MergeFiles(files), nil
+}
+
+func isModuleFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+// ModuleNode wraps the nodes of a Terraform module so that the `/>>` operator
+// can follow module calls with a local source into the called module. The
+// attributes projected out of a module are wrapped as well, so that they keep
+// the call path.
+type ModuleNode struct {
+	Node
+	loader *moduleLoader
+	dir    string
+	call   []string
+	dirs   []string
+}
+
+// CallPath returns the names of the module calls leading to this node, outermost
+// first. It is empty for nodes of the root module.
+func (n *ModuleNode) CallPath() []string {
+	return n.call
+}
+
+func (n *ModuleNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	blocks, diags := n.Node.Blocks(typeName)
+	nodes := make(Nodes, 0, len(blocks))
+	for _, b := range blocks {
+		nodes = append(nodes, n.wrap(b))
+	}
+	return nodes, diags
+}
+
+// wrap returns child, a block or an attribute of this node, as a node of the
+// same module.
+func (n *ModuleNode) wrap(child Node) *ModuleNode {
+	return &ModuleNode{
+		Node:   child,
+		loader: n.loader,
+		dir:    n.dir,
+		call:   n.call,
+		dirs:   n.dirs,
+	}
+}
+
+// Enter returns the root of the module called by this module block. It
+// returns nil when the module source is not a local directory.
+func (n *ModuleNode) Enter() (*ModuleNode, error) {
+	if n.Type() != "module" || len(n.Labels()) == 0 {
+		return nil, fmt.Errorf("block '%v' is not a module call", n.Type())
+	}
+	name := n.Labels()[0]
+	attrs, _ := n.Attributes()
+	attr, ok := attrs["source"]
+	if !ok {
+		return nil, fmt.Errorf("module '%v' has no source", name)
+	}
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || !val.Type().Equals(cty.String) {
+		return nil, fmt.Errorf("module '%v' source is not a string", name)
+	}
+	source := val.AsString()
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		n.loader.logger.Debug("Skipping module with a non local source", "module", name, "source", source)
+		return nil, nil
+	}
+
+	dir := path.Join(n.dir, source)
+	if slices.Contains(n.dirs, dir) {
+		return nil, fmt.Errorf("module cycle detected: %v -> %v", strings.Join(n.dirs, " -> "), dir)
+	}
+	body, err := n.loader.load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &ModuleNode{
+		Node:   NewBodyNode(body, TerraformLabels),
+		loader: n.loader,
+		dir:    dir,
+		call:   append(slices.Clip(n.call), name),
+		dirs:   append(slices.Clip(n.dirs), dir),
+	}, nil
+}
+
+// QueryModule evaluates path against the Terraform module in dir of fsys.
+// Unlike QueryFS, module calls with a local source can be followed with the
+// `/>>` operator, e.g. `module:app/>>resource:aws_iam_role`. Matches carry the
+// call path of the module they were found in.
+func QueryModule(fsys fs.FS, dir string, path string, opts ...Option) ([]Match, error) {
+	compilation, err := Compile(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	loader := &moduleLoader{
+		fsys:   fsys,
+		parser: hclparse.NewParser(),
+		logger: compilation.cfg.logger,
+	}
+	body, err := loader.load(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := &ModuleNode{
+		Node:   NewBodyNode(body, TerraformLabels),
+		loader: loader,
+		dir:    dir,
+		dirs:   []string{dir},
+	}
+
+	blocks, err := compilation.Exec(Nodes{root})
+	if err != nil {
+		return nil, err
+	}
+	matches := []Match{}
+	for _, b := range blocks {
+		m := Match{File: b.DefRange().Filename, Node: b}
+		if mn, ok := b.(*ModuleNode); ok {
+			m.Module = mn.CallPath()
+		}
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
@@ -0,0 +1,357 @@
+package hclpath
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Node is a backend-agnostic view of an HCL block that the evaluator walks.
+// The root of a file is represented as a Node with an empty type and no
+// labels.
+type Node interface {
+	Type() string
+	Labels() []string
+	Body() hcl.Body
+	DefRange() hcl.Range
+	// Attributes lists the attributes of the body. JSON bodies cannot tell
+	// blocks from attributes, so adapters reading them may list child blocks
+	// as attributes as well.
+	Attributes() (hcl.Attributes, hcl.Diagnostics)
+	Blocks(typeName string) (Nodes, hcl.Diagnostics)
+	// BlockTypes lists the types of the child blocks, in order of first
+	// appearance. Adapters that cannot tell blocks from attributes may list
+	// attribute names as well.
+	BlockTypes() []string
+}
+
+type Nodes []Node
+
+// NewNode wraps a body into a root Node, picking the adapter that matches the
+// body implementation. Bodies read from .tf.json files get the label counts of
+// TerraformLabels, rather than guessed ones.
+func NewNode(body hcl.Body) Node {
+	if b, ok := body.(*hclsyntax.Body); ok {
+		return NewSyntaxNode(b)
+	}
+	if strings.HasSuffix(body.MissingItemRange().Filename, ".tf.json") {
+		return NewBodyNode(body, TerraformLabels)
+	}
+	return NewBodyNode(body, nil)
+}
+
+// SyntaxNode adapts bodies and blocks of the native HCL syntax.
+type SyntaxNode struct {
+	block *hclsyntax.Block
+	body  *hclsyntax.Body
+}
+
+func NewSyntaxNode(body *hclsyntax.Body) *SyntaxNode {
+	return &SyntaxNode{body: body}
+}
+
+// Block returns the wrapped block, or nil for a root node.
+func (n *SyntaxNode) Block() *hclsyntax.Block {
+	return n.block
+}
+
+func (n *SyntaxNode) Type() string {
+	if n.block == nil {
+		return ""
+	}
+	return n.block.Type
+}
+
+func (n *SyntaxNode) Labels() []string {
+	if n.block == nil {
+		return nil
+	}
+	return n.block.Labels
+}
+
+func (n *SyntaxNode) Body() hcl.Body {
+	return n.body
+}
+
+func (n *SyntaxNode) DefRange() hcl.Range {
+	if n.block == nil {
+		return n.body.SrcRange
+	}
+	return n.block.DefRange()
+}
+
+func (n *SyntaxNode) Attributes() (hcl.Attributes, hcl.Diagnostics) {
+	return n.body.JustAttributes()
+}
+
+func (n *SyntaxNode) BlockTypes() []string {
+	types := []string{}
+	for _, b := range n.body.Blocks {
+		if !slices.Contains(types, b.Type) {
+			types = append(types, b.Type)
+		}
+	}
+	return types
+}
+
+func (n *SyntaxNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	nodes := Nodes{}
+	for _, b := range n.body.Blocks {
+		if b.Type == typeName {
+			nodes = append(nodes, &SyntaxNode{block: b, body: b.Body})
+		}
+	}
+	return nodes, nil
+}
+
+// maxLabels is the largest number of labels probed for a block type whose
+// label count is not known in advance.
+const maxLabels = 3
+
+// TerraformLabels holds the label count of the Terraform block types, for use
+// with NewBodyNode.
+var TerraformLabels = map[string]int{
+	"terraform":          0,
+	"required_providers": 0,
+	"backend":            1,
+	"cloud":              0,
+	"provider":           1,
+	"variable":           1,
+	"output":             1,
+	"locals":             0,
+	"module":             1,
+	"resource":           2,
+	"data":               2,
+	"provisioner":        1,
+	"connection":         0,
+	"lifecycle":          0,
+	"moved":              0,
+	"import":             0,
+	"removed":            0,
+	"check":              1,
+}
+
+// BodyNode adapts any hcl.Body, such as those produced by the JSON parser or
+// by hcl.MergeFiles, by reading blocks through a schema.
+//
+// A body cannot be asked which blocks it holds without a schema, and a schema
+// has to name the labels of each block type. Label counts are taken from the
+// labels map when present. Otherwise, the largest count up to maxLabels that
+// decodes without errors is used. This is exact for native syntax bodies, but
+// only a best guess for JSON, where an object nested deep enough can always be
+// read as one more label.
+type BodyNode struct {
+	block  *hcl.Block
+	body   hcl.Body
+	labels map[string]int
+}
+
+// NewBodyNode wraps body into a root Node. labels may be nil.
+func NewBodyNode(body hcl.Body, labels map[string]int) *BodyNode {
+	return &BodyNode{body: body, labels: labels}
+}
+
+// Block returns the wrapped block, or nil for a root node.
+func (n *BodyNode) Block() *hcl.Block {
+	return n.block
+}
+
+func (n *BodyNode) Type() string {
+	if n.block == nil {
+		return ""
+	}
+	return n.block.Type
+}
+
+func (n *BodyNode) Labels() []string {
+	if n.block == nil {
+		return nil
+	}
+	return n.block.Labels
+}
+
+func (n *BodyNode) Body() hcl.Body {
+	return n.body
+}
+
+func (n *BodyNode) DefRange() hcl.Range {
+	if n.block == nil {
+		return n.body.MissingItemRange()
+	}
+	return n.block.DefRange
+}
+
+// Attributes leaves out the objects and arrays named after a block type of
+// the labels map, which JSON bodies would otherwise list as attributes. Other
+// blocks of JSON bodies are still listed.
+func (n *BodyNode) Attributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := n.body.JustAttributes()
+	for name, attr := range attrs {
+		if _, ok := n.labels[name]; ok && isCollection(attr.Expr) {
+			delete(attrs, name)
+		}
+	}
+	return attrs, diags
+}
+
+// isCollection tells whether expr is an object or an array, as JSON blocks
+// are.
+func isCollection(expr hcl.Expression) bool {
+	if _, diags := hcl.ExprMap(expr); !diags.HasErrors() {
+		return true
+	}
+	_, diags := hcl.ExprList(expr)
+	return !diags.HasErrors()
+}
+
+// BlockTypes lists the types of the child blocks of native syntax bodies,
+// including those merged by hcl.MergeFiles, and the names of every attribute
+// of JSON bodies, which cannot tell them apart from blocks.
+func (n *BodyNode) BlockTypes() []string {
+	return blockTypes(n.body)
+}
+
+func blockTypes(body hcl.Body) []string {
+	if b, ok := body.(*hclsyntax.Body); ok {
+		return NewSyntaxNode(b).BlockTypes()
+	}
+	if parts, ok := mergedParts(body); ok {
+		types := []string{}
+		for _, part := range parts {
+			for _, t := range blockTypes(part) {
+				if !slices.Contains(types, t) {
+					types = append(types, t)
+				}
+			}
+		}
+		return types
+	}
+
+	attrs, _ := body.JustAttributes()
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		sorted = append(sorted, a)
+	}
+	slices.SortFunc(sorted, func(a, b *hcl.Attribute) int {
+		return a.Range.Start.Byte - b.Range.Start.Byte
+	})
+	types := make([]string, 0, len(sorted))
+	for _, a := range sorted {
+		types = append(types, a.Name)
+	}
+	return types
+}
+
+// bodyType is the type of hcl.Body, as held by the bodies merged by
+// hcl.MergeBodies.
+var bodyType = reflect.TypeFor[hcl.Body]()
+
+// mergedParts returns the bodies merged into body by hcl.MergeBodies or
+// hcl.MergeFiles. The merged body type is not exported, but it is a slice of
+// the merged bodies.
+func mergedParts(body hcl.Body) ([]hcl.Body, bool) {
+	v := reflect.ValueOf(body)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != bodyType {
+		return nil, false
+	}
+	parts := make([]hcl.Body, 0, v.Len())
+	for i := range v.Len() {
+		if part, ok := v.Index(i).Interface().(hcl.Body); ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts, true
+}
+
+func (n *BodyNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	if count, ok := n.labels[typeName]; ok {
+		blocks, diags := n.blocksWithLabels(typeName, count)
+		return n.wrap(blocks), diags
+	}
+
+	var diags hcl.Diagnostics
+	for count := maxLabels; count >= 0; count-- {
+		var blocks hcl.Blocks
+		blocks, diags = n.blocksWithLabels(typeName, count)
+		if !diags.HasErrors() {
+			return n.wrap(blocks), diags
+		}
+	}
+	return Nodes{}, diags
+}
+
+func (n *BodyNode) blocksWithLabels(typeName string, count int) (hcl.Blocks, hcl.Diagnostics) {
+	labelNames := make([]string, count)
+	for i := range labelNames {
+		labelNames[i] = "label"
+	}
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       typeName,
+				LabelNames: labelNames,
+			},
+		},
+	}
+	content, _, diags := n.body.PartialContent(schema)
+	if content == nil {
+		return nil, diags
+	}
+	return content.Blocks, diags
+}
+
+func (n *BodyNode) wrap(blocks hcl.Blocks) Nodes {
+	nodes := Nodes{}
+	for _, b := range blocks {
+		nodes = append(nodes, &BodyNode{block: b, body: b.Body, labels: n.labels})
+	}
+	return nodes
+}
+
+// AttrNode is an attribute projected by a query, as in `provider:aws/@region`.
+// Its type is the attribute name prefixed with '@', which no block type can
+// be, and it has no labels, attributes or blocks.
+type AttrNode struct {
+	attr *hcl.Attribute
+}
+
+// NewAttrNode wraps attr into a Node.
+func NewAttrNode(attr *hcl.Attribute) *AttrNode {
+	return &AttrNode{attr: attr}
+}
+
+// Attribute returns the wrapped attribute.
+func (n *AttrNode) Attribute() *hcl.Attribute {
+	return n.attr
+}
+
+func (n *AttrNode) Type() string {
+	return "@" + n.attr.Name
+}
+
+func (n *AttrNode) Labels() []string {
+	return nil
+}
+
+func (n *AttrNode) Body() hcl.Body {
+	return hcl.EmptyBody()
+}
+
+func (n *AttrNode) DefRange() hcl.Range {
+	return n.attr.Range
+}
+
+func (n *AttrNode) Attributes() (hcl.Attributes, hcl.Diagnostics) {
+	return hcl.Attributes{}, nil
+}
+
+func (n *AttrNode) Blocks(typeName string) (Nodes, hcl.Diagnostics) {
+	return Nodes{}, nil
+}
+
+func (n *AttrNode) BlockTypes() []string {
+	return nil
+}
@@ -0,0 +1,110 @@
+package hclpath
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kdehairy/hclpath/v2/logging"
+)
+
+// defaultLogger is used by queries that are not given a logger. It is only
+// built, reading the GO_LOG_LEVEL environment variable, on first use.
+var defaultLogger = sync.OnceValue(logging.NewDefaultLogger)
+
+// Mode tells how evaluation reacts to anomalies met in the queried blocks:
+//   - a selection index out of bound,
+//   - attributes that cannot be read from a block,
+//   - an attribute value that cannot be evaluated,
+//   - an attribute value that cannot be compared to a literal, either because
+//     of its type or because the literal does not convert to it.
+//
+// Blocks of a type that cannot be decoded from a JSON body are not anomalies;
+// they are not blocks as far as the query is concerned.
+type Mode int
+
+const (
+	// Strict fails the execution on the first anomaly, with an
+	// hcl.Diagnostics error pointing at the offending block or attribute.
+	Strict Mode = iota
+	// Lenient skips whatever caused an anomaly and carries on. The anomaly is
+	// collected as a warning on the Result.
+	Lenient
+)
+
+// Option configures the compilation and execution of a query, and the edits
+// made at its matches.
+type Option func(*config)
+
+type config struct {
+	logger     *slog.Logger
+	ignoreCase bool
+	mode       Mode
+	evalCtx    *hcl.EvalContext
+	limits     Limits
+	trace      bool
+	// references and referenceFiles are only used by RenameLabel and
+	// RenameAlias.
+	references     bool
+	referenceFiles []*hclwrite.File
+	// ifMissing is only used by Insert.
+	ifMissing bool
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.logger == nil {
+		cfg.logger = defaultLogger()
+	}
+	return cfg
+}
+
+// WithLogger sets the logger used instead of the package default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithIgnoreCase matches block types, labels and attribute names regardless of
+// their case.
+func WithIgnoreCase() Option {
+	return func(c *config) {
+		c.ignoreCase = true
+	}
+}
+
+// WithMode sets the evaluation mode. The default is Strict.
+func WithMode(mode Mode) Option {
+	return func(c *config) {
+		c.mode = mode
+	}
+}
+
+// WithEvalContext sets the context attribute values are evaluated in when
+// compared against literals, so that they may refer to variables and call
+// functions.
+func WithEvalContext(ctx *hcl.EvalContext) Option {
+	return func(c *config) {
+		c.evalCtx = ctx
+	}
+}
+
+// WithLimits bounds every execution of the query.
+func WithLimits(limits Limits) Option {
+	return func(c *config) {
+		c.limits = limits
+	}
+}
+
+func (c *config) equal(a, b string) bool {
+	if c.ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -2,7 +2,6 @@ package parse
 
 import (
 	"fmt"
-	"log"
 	"strconv"
 
 	"github.com/kdehairy/hclpath/v2/lex"
@@ -11,11 +10,13 @@ import (
 type Node string
 
 const (
-	Type     Node = "type"
-	Attr     Node = "attr"
-	Num      Node = "num"
-	Str      Node = "str"
-	Label    Node = "label"
+	Type  Node = "type"
+	Attr  Node = "attr"
+	Num   Node = "num"
+	Str   Node = "str"
+	Label Node = "label"
+	// Root is the node a query is executed against, written '.'.
+	Root     Node = "root"
 	Operator Node = "Operator"
 )
 
@@ -33,6 +34,12 @@ type Ident struct {
 	ntype Node
 }
 
+// NewIdent returns an identifier of type ntype, which is one of Type, Label
+// or Attr, or Root with the value ".".
+func NewIdent(ntype Node, value string) *Ident {
+	return &Ident{value: value, ntype: ntype}
+}
+
 func (i *Ident) Print() string {
 	return i.value
 }
@@ -64,6 +71,8 @@ const (
 	FltOp Op = "{}"
 	LblOp Op = ":"
 	NstOp Op = "/"
+	EntOp Op = "/>>"
+	PrjOp Op = "/@"
 	EqlOp Op = "="
 )
 
@@ -71,6 +80,10 @@ func FromToken(tk lex.Token) (op Op) {
 	switch tk {
 	case lex.NEST:
 		op = NstOp
+	case lex.INTO:
+		op = EntOp
+	case lex.PROJECT:
+		op = PrjOp
 	case lex.SELECT_START:
 		op = SelOp
 	case lex.FILTER_START:
@@ -84,6 +97,9 @@ func FromToken(tk lex.Token) (op Op) {
 }
 
 func (o Op) print() string {
+	if o == "" {
+		return "<nil>"
+	}
 	return string(o)
 }
 
@@ -93,20 +109,27 @@ type BinOp struct {
 	Op  Op
 }
 
+func NewBinOp(op Op, lhs Expr, rhs Expr) *BinOp {
+	return &BinOp{Op: op, Lhs: lhs, Rhs: rhs}
+}
+
+// Print renders the operation for debugging. A missing side or operator,
+// which only hand-built ASTs can have, is rendered as `<nil>`.
 func (o *BinOp) Print() string {
-	if o.Lhs == nil {
-		log.Fatal("Lhs cannot be nil")
-	}
-	if o.Rhs == nil {
-		log.Fatal("Rhs cannot be nil")
-	}
-	if o.Op == "" {
-		log.Fatal("Operator cannot be nil")
+	if o == nil {
+		return "<nil>"
 	}
 	return fmt.Sprintf("(%v-%v-%v)",
-		o.Lhs.Print(),
+		printExpr(o.Lhs),
 		o.Op.print(),
-		o.Rhs.Print())
+		printExpr(o.Rhs))
+}
+
+func printExpr(expr Expr) string {
+	if expr == nil {
+		return "<nil>"
+	}
+	return expr.Print()
 }
 
 func (o *BinOp) GetLeft() Expr {
@@ -133,6 +156,10 @@ type NumLt struct {
 	value int
 }
 
+func NewNumLt(value int) *NumLt {
+	return &NumLt{value: value}
+}
+
 func (o *NumLt) Print() string {
 	return strconv.Itoa(o.value)
 }
@@ -161,6 +188,10 @@ type StrLt struct {
 	value string
 }
 
+func NewStrLt(value string) *StrLt {
+	return &StrLt{value: value}
+}
+
 func (o *StrLt) Print() string {
 	return o.value
 }
@@ -184,3 +215,20 @@ func (o *StrLt) GetVal() interface{} {
 func (o *StrLt) GetType() Node {
 	return Str
 }
+
+// Equal reports whether two ASTs are structurally equal: same shape, same
+// operators, and leaves of the same type and value.
+func Equal(a Expr, b Expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if (a.GetOp() == nil) != (b.GetOp() == nil) {
+		return false
+	}
+	if a.GetOp() == nil {
+		return a.GetType() == b.GetType() && a.GetVal() == b.GetVal()
+	}
+	return *a.GetOp() == *b.GetOp() &&
+		Equal(a.GetLeft(), b.GetLeft()) &&
+		Equal(a.GetRight(), b.GetRight())
+}
@@ -0,0 +1,154 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kdehairy/hclpath/v2/lex"
+)
+
+// Format renders an AST as canonical query text: no white space, names bare
+// unless they need quoting, and literals in single quotes unless they hold one,
+// escaped where needed. Parsing the result of Format yields an AST
+// structurally equal to expr, for any AST the parser can produce. Other
+// valid ASTs, such as rewritten ones with a path on the right side of `/`,
+// come back in the parser's left-associative shape, which evaluates the same.
+// ASTs the grammar cannot express are reported as errors.
+func Format(expr Expr) (string, error) {
+	var sb strings.Builder
+	if err := formatPath(&sb, expr, Root); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// formatPath renders a path whose leftmost identifier is of type first. Root
+// stands for the start of a query, where either the root or a block type is
+// allowed.
+func formatPath(sb *strings.Builder, expr Expr, first Node) error {
+	if expr == nil {
+		return fmt.Errorf("expected an expression, but found none")
+	}
+	if expr.GetOp() == nil {
+		return formatLeaf(sb, expr, first)
+	}
+
+	op := *expr.GetOp()
+	if err := formatPath(sb, expr.GetLeft(), first); err != nil {
+		return err
+	}
+	switch op {
+	case NstOp, EntOp:
+		sb.WriteString(string(op))
+		return formatPath(sb, expr.GetRight(), Type)
+	case PrjOp:
+		sb.WriteString(string(op))
+		return formatLeaf(sb, expr.GetRight(), Attr)
+	case LblOp:
+		sb.WriteString(string(op))
+		return formatPath(sb, expr.GetRight(), Label)
+	case FltOp:
+		sb.WriteString("{")
+		if err := formatPredicate(sb, expr.GetRight()); err != nil {
+			return err
+		}
+		sb.WriteString("}")
+	case SelOp:
+		sb.WriteString("[")
+		if err := formatLeaf(sb, expr.GetRight(), Num); err != nil {
+			return err
+		}
+		sb.WriteString("]")
+	default:
+		return fmt.Errorf("operator '%v' is not allowed in a path", op)
+	}
+	return nil
+}
+
+func formatPredicate(sb *strings.Builder, expr Expr) error {
+	if expr == nil || expr.GetOp() == nil {
+		return formatLeaf(sb, expr, Attr)
+	}
+	if *expr.GetOp() != EqlOp {
+		return fmt.Errorf("operator '%v' is not allowed in a filter", *expr.GetOp())
+	}
+	if err := formatLeaf(sb, expr.GetLeft(), Attr); err != nil {
+		return err
+	}
+	sb.WriteString(string(EqlOp))
+	return formatLeaf(sb, expr.GetRight(), Str)
+}
+
+func formatLeaf(sb *strings.Builder, expr Expr, want Node) error {
+	if expr == nil {
+		return fmt.Errorf("expected %v, but found none", want)
+	}
+	if want == Root && expr.GetType() == Type {
+		want = Type
+	}
+	if expr.GetType() != want {
+		return fmt.Errorf("expected %v, but found %v '%v'", want, expr.GetType(), expr.GetVal())
+	}
+	switch want {
+	case Root:
+		sb.WriteString(".")
+	case Type, Label, Attr:
+		name, ok := expr.GetVal().(string)
+		if !ok {
+			return fmt.Errorf("'%v' is not a valid identifier", expr.GetVal())
+		}
+		if lex.IsIdent(name) {
+			sb.WriteString(name)
+		} else {
+			sb.WriteString(quote(name))
+		}
+	case Num:
+		i, ok := expr.GetVal().(int)
+		if !ok {
+			return fmt.Errorf("expected integer, but found '%v'", expr.GetVal())
+		}
+		sb.WriteString(strconv.Itoa(i))
+	case Str:
+		s, ok := expr.GetVal().(string)
+		if !ok {
+			return fmt.Errorf("expected string, but found '%v'", expr.GetVal())
+		}
+		sb.WriteString(quote(s))
+	default:
+		return fmt.Errorf("unknown expression type '%v'", expr.GetType())
+	}
+	return nil
+}
+
+// quote renders s as a literal, in single quotes unless it holds one and no
+// double quote. Backslashes, the chosen quote and control characters are
+// escaped.
+func quote(s string) string {
+	q := '\''
+	if strings.ContainsRune(s, '\'') && !strings.ContainsRune(s, '"') {
+		q = '"'
+	}
+	var sb strings.Builder
+	sb.WriteRune(q)
+	for _, ch := range s {
+		switch {
+		case ch == q || ch == '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(ch)
+		case ch == '\n':
+			sb.WriteString(`\n`)
+		case ch == '\r':
+			sb.WriteString(`\r`)
+		case ch == '\t':
+			sb.WriteString(`\t`)
+		case unicode.IsControl(ch):
+			fmt.Fprintf(&sb, `\u%04x`, ch)
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	sb.WriteRune(q)
+	return sb.String()
+}
@@ -67,17 +67,20 @@ func (p *Parser) consume(expected lex.Token) (bool, error) {
 	return true, nil
 }
 
-func (p *Parser) parseIdent() (Expr, error) {
+// parseIdent reads an identifier of type ntype, either bare or quoted.
+func (p *Parser) parseIdent(ntype Node) (Expr, error) {
 	tk, lt := p.scanIgnoreWhitespace()
-	if tk != lex.IDENT {
+	if tk == lex.ILLEGAL && p.s.Err() != nil {
+		return nil, p.s.Err()
+	}
+	if tk != lex.IDENT && tk != lex.LITERAL {
 		return nil, fmt.Errorf("expected identifier found %v", tk)
 	}
-	return &Ident{value: lt}, nil
+	return &Ident{value: lt, ntype: ntype}, nil
 }
 
 func (p *Parser) parseFilter() (Expr, error) {
-	lhs, err := p.parseIdent()
-	lhs.(*Ident).ntype = Attr
+	lhs, err := p.parseIdent(Attr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parser filter: %v", err)
 	}
@@ -99,6 +102,9 @@ func (p *Parser) parseFilter() (Expr, error) {
 
 func (p *Parser) parseLiteral() (Expr, error) {
 	tk, lt := p.scanIgnoreWhitespace()
+	if tk == lex.ILLEGAL && p.s.Err() != nil {
+		return nil, p.s.Err()
+	}
 	if tk != lex.LITERAL {
 		return nil, fmt.Errorf("expected %v found %v", lex.LITERAL, tk)
 	}
@@ -123,9 +129,21 @@ func (p *Parser) parseNum() (Expr, error) {
 	}, nil
 }
 
+// parseStart reads the first segment of a path: a block type, or the root,
+// either explicit as '.' or implied by a leading operator as in '/@region'.
+func (p *Parser) parseStart() (Expr, error) {
+	switch p.peek() {
+	case lex.ROOT:
+		p.scanIgnoreWhitespace()
+		return NewIdent(Root, "."), nil
+	case lex.NEST, lex.PROJECT:
+		return NewIdent(Root, "."), nil
+	}
+	return p.parseIdent(Type)
+}
+
 func (p *Parser) Parse() (Expr, error) {
-	lhs, err := p.parseIdent()
-	lhs.(*Ident).ntype = Type
+	lhs, err := p.parseStart()
 	if err != nil {
 		return nil, fmt.Errorf("syntax error: %v", err)
 	}
@@ -137,19 +155,25 @@ func (p *Parser) Parse() (Expr, error) {
 		var err error
 		op := FromToken(tk)
 		switch tk {
-		case lex.NEST:
-			rhs, err = p.parseIdent()
-			rhs.(*Ident).ntype = Type
+		case lex.NEST, lex.INTO:
+			rhs, err = p.parseIdent(Type)
+		case lex.PROJECT:
+			rhs, err = p.parseIdent(Attr)
 		case lex.NAMED:
-			rhs, err = p.parseIdent()
-			rhs.(*Ident).ntype = Label
+			rhs, err = p.parseIdent(Label)
 		case lex.FILTER_START:
 			rhs, err = p.parseFilter()
+			if err != nil {
+				break
+			}
 			if ok, error := p.consume(lex.FILTER_END); !ok {
 				return nil, error
 			}
 		case lex.SELECT_START:
 			rhs, err = p.parseNum()
+			if err != nil {
+				break
+			}
 			if ok, error := p.consume(lex.SELECT_END); !ok {
 				return nil, error
 			}
@@ -164,5 +188,11 @@ func (p *Parser) Parse() (Expr, error) {
 		}
 	}
 
+	if tk, lt := p.scanIgnoreWhitespace(); tk != lex.EOF {
+		if tk == lex.ILLEGAL && p.s.Err() != nil {
+			return nil, fmt.Errorf("syntax error: %v", p.s.Err())
+		}
+		return nil, fmt.Errorf("syntax error: unexpected '%v' after the path", lt)
+	}
 	return lhs, nil
 }
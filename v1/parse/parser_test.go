@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -18,6 +19,11 @@ func TestParser(t *testing.T) {
 			fixture:  "first/second",
 			expected: "(first-/-second)",
 		},
+		{
+			name:     "first:label/>>second",
+			fixture:  "first:label/>>second",
+			expected: "((first-:-label)-/>>-second)",
+		},
 		{
 			name:     "first:label",
 			fixture:  "first:label",
@@ -63,6 +69,46 @@ func TestParser(t *testing.T) {
 			fixture:  "first:label{attr}",
 			expected: "((first-:-label)-{}-attr)",
 		},
+		{
+			name:     "root",
+			fixture:  ".",
+			expected: ".",
+		},
+		{
+			name:     "filtered root",
+			fixture:  ".{environment='prod'}",
+			expected: "(.-{}-(environment-=-prod))",
+		},
+		{
+			name:     "root attribute",
+			fixture:  "/@region",
+			expected: "(.-/@-region)",
+		},
+		{
+			name:     "root block",
+			fixture:  "/provider",
+			expected: "(.-/-provider)",
+		},
+		{
+			name:     "block attribute",
+			fixture:  "provider:aws/@region",
+			expected: "((provider-:-aws)-/@-region)",
+		},
+		{
+			name:     "quoted label",
+			fixture:  `provider:"aws.west"/assume_role`,
+			expected: "((provider-:-aws.west)-/-assume_role)",
+		},
+		{
+			name:     "quoted type",
+			fixture:  `'source':"amazon-ebs.ubuntu"`,
+			expected: "(source-:-amazon-ebs.ubuntu)",
+		},
+		{
+			name:     "unicode identifiers",
+			fixture:  "job:café/tâche",
+			expected: "((job-:-café)-/-tâche)",
+		},
 	}
 
 	for _, tc := range cases {
@@ -81,3 +127,295 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParserErrors(t *testing.T) {
+	cases := []TestCase{
+		{
+			name:     "unterminated literal",
+			fixture:  "first{attr='val}",
+			expected: "unterminated literal 'val}",
+		},
+		{
+			name:     "empty query",
+			fixture:  "",
+			expected: "expected identifier found EOF",
+		},
+		{
+			name:     "missing type",
+			fixture:  "provider/",
+			expected: "expected identifier found EOF",
+		},
+		{
+			name:     "missing label",
+			fixture:  "provider:",
+			expected: "expected identifier found EOF",
+		},
+		{
+			name:     "missing attribute",
+			fixture:  "provider{}",
+			expected: "expected identifier found }",
+		},
+		{
+			name:     "unterminated label",
+			fixture:  "provider:'aws",
+			expected: "unterminated literal 'aws",
+		},
+		{
+			name:     "invalid escape",
+			fixture:  `first{attr='\q'}`,
+			expected: `invalid escape sequence '\q'`,
+		},
+		{
+			name:     "type after the root",
+			fixture:  ".terraform",
+			expected: "unexpected 'terraform' after the path",
+		},
+		{
+			name:     "label without an operator",
+			fixture:  "provider aws",
+			expected: "unexpected 'aws' after the path",
+		},
+		{
+			name:     "trailing literal",
+			fixture:  "provider:aws 'x'",
+			expected: "unexpected 'x' after the path",
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(tc.fixture)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected '%v' but found '%v'", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	expr := NewBinOp(FltOp,
+		NewBinOp(LblOp, NewIdent(Type, "first"), NewIdent(Label, "label")),
+		NewBinOp(EqlOp, NewIdent(Attr, "attr"), NewStrLt("val")))
+	expected := "((first-:-label)-{}-(attr-=-val))"
+	if expr.Print() != expected {
+		t.Fatalf("expected '%v' but found '%v'", expected, expr.Print())
+	}
+
+	sel := NewBinOp(SelOp, NewIdent(Type, "first"), NewNumLt(12))
+	if sel.GetRight().GetVal() != 12 || sel.GetLeft().GetType() != Type {
+		t.Fatalf("unexpected expression '%v'", sel.Print())
+	}
+
+	partial := NewBinOp("", NewIdent(Type, "first"), nil)
+	expected = "(first-<nil>-<nil>)"
+	if partial.Print() != expected {
+		t.Fatalf("expected '%v' but found '%v'", expected, partial.Print())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	p := NewParser(strings.NewReader("first:label{attr='val'}/second[1]"))
+	expr, err := p.Parse()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var visited []string
+	Inspect(expr, func(e Expr) bool {
+		if e == nil {
+			return false
+		}
+		if e.GetOp() == nil {
+			visited = append(visited, fmt.Sprintf("%v:%v", e.GetType(), e.Print()))
+		}
+		return true
+	})
+	expected := "type:first label:label attr:attr str:val type:second num:1"
+	if strings.Join(visited, " ") != expected {
+		t.Fatalf("expected '%v' but found '%v'", expected, strings.Join(visited, " "))
+	}
+
+	count := 0
+	Inspect(expr, func(e Expr) bool {
+		if e != nil {
+			count++
+		}
+		return e != nil && e.GetOp() != nil && *e.GetOp() != FltOp
+	})
+	if count != 5 {
+		t.Fatalf("expected '5' visited expressions but found '%v'", count)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	p := NewParser(strings.NewReader("bucket{acl='private'}/versioning"))
+	expr, err := p.Parse()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	original := expr.Print()
+
+	rewritten := Rewrite(expr, func(e Expr) Expr {
+		if e.GetType() == Type && e.GetVal() == "bucket" {
+			return NewBinOp(LblOp, NewIdent(Type, "resource"), NewIdent(Label, "aws_s3_bucket"))
+		}
+		return e
+	})
+
+	expected := "(((resource-:-aws_s3_bucket)-{}-(acl-=-private))-/-versioning)"
+	if rewritten.Print() != expected {
+		t.Fatalf("expected '%v' but found '%v'", expected, rewritten.Print())
+	}
+	if expr.Print() != original {
+		t.Fatalf("expected the original to be left as '%v' but found '%v'", original, expr.Print())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []TestCase{
+		{
+			name:     "path",
+			fixture:  "first / second : label",
+			expected: "first/second:label",
+		},
+		{
+			name:     "filter with value",
+			fixture:  `first{ attr = "val" }`,
+			expected: "first{attr='val'}",
+		},
+		{
+			name:     "filter without value",
+			fixture:  "first:label{attr}",
+			expected: "first:label{attr}",
+		},
+		{
+			name:     "selection",
+			fixture:  "first[ 12 ]/second",
+			expected: "first[12]/second",
+		},
+		{
+			name:     "into module",
+			fixture:  "module:app/>>resource",
+			expected: "module:app/>>resource",
+		},
+		{
+			name:     "literal with single quote",
+			fixture:  `first{attr="it's"}`,
+			expected: `first{attr="it's"}`,
+		},
+		{
+			name:     "literal with both quotes",
+			fixture:  `first{attr='it\'s "quoted"'}`,
+			expected: `first{attr='it\'s "quoted"'}`,
+		},
+		{
+			name:     "literal with escapes",
+			fixture:  `first{attr="a\\b\n\u00e9"}`,
+			expected: "first{attr='a\\\\b\\né'}",
+		},
+		{
+			name:     "quoted names",
+			fixture:  `"amazon-ebs.ubuntu":"aws.west"{'a b'}`,
+			expected: `'amazon-ebs.ubuntu':'aws.west'{'a b'}`,
+		},
+		{
+			name:     "quoted bare names",
+			fixture:  `provider:"aws"`,
+			expected: `provider:aws`,
+		},
+		{
+			name:     "unicode names",
+			fixture:  `job:"dépôt"/tâche`,
+			expected: `job:dépôt/tâche`,
+		},
+		{
+			name:     "root attribute",
+			fixture:  "/@region",
+			expected: "./@region",
+		},
+		{
+			name:     "filtered root attribute",
+			fixture:  ". { env = 'prod' } /@ 'app.name'",
+			expected: ".{env='prod'}/@'app.name'",
+		},
+		{
+			name:     "literal with slashes and colons",
+			fixture:  "first{attr='arn:aws:iam::0987654321:role/x'}",
+			expected: "first{attr='arn:aws:iam::0987654321:role/x'}",
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		testName = strings.ToLower(testName)
+		t.Run(testName, func(t *testing.T) {
+			expr, err := NewParser(strings.NewReader(tc.fixture)).Parse()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			found, err := Format(expr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if tc.expected != found {
+				t.Fatalf("expected '%v' but found '%v'", tc.expected, found)
+			}
+			again, err := NewParser(strings.NewReader(found)).Parse()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if !Equal(expr, again) {
+				t.Fatalf("expected '%v' but found '%v'", expr.Print(), again.Print())
+			}
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		expr Expr
+	}{
+		{
+			name: "path inside a filter",
+			expr: NewBinOp(FltOp, NewIdent(Type, "first"), NewBinOp(NstOp, NewIdent(Type, "a"), NewIdent(Type, "b"))),
+		},
+		{
+			name: "root after a nest operator",
+			expr: NewBinOp(NstOp, NewIdent(Type, "first"), NewIdent(Root, ".")),
+		},
+		{
+			name: "type after a label operator",
+			expr: NewBinOp(LblOp, NewIdent(Type, "first"), NewIdent(Type, "second")),
+		},
+		{
+			name: "missing side",
+			expr: &BinOp{Op: NstOp, Lhs: NewIdent(Type, "first")},
+		},
+	}
+
+	for _, tc := range cases {
+		testName := strings.ReplaceAll(tc.name, " ", "_")
+		t.Run(testName, func(t *testing.T) {
+			if _, err := Format(tc.expr); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	t.Run("rewritten_path", func(t *testing.T) {
+		expr := NewBinOp(NstOp, NewIdent(Type, "first"), NewBinOp(LblOp, NewIdent(Type, "second"), NewIdent(Label, "label")))
+		found, err := Format(expr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if found != "first/second:label" {
+			t.Fatalf("expected 'first/second:label' but found '%v'", found)
+		}
+	})
+}
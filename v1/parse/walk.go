@@ -0,0 +1,53 @@
+package parse
+
+// Visitor's Visit method is invoked for each expression met by Walk. If the
+// returned visitor w is not nil, Walk visits each of the children of expr
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(expr Expr) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, left side first: it starts by
+// calling v.Visit(expr).
+func Walk(v Visitor, expr Expr) {
+	if v = v.Visit(expr); v == nil {
+		return
+	}
+	if l := expr.GetLeft(); l != nil {
+		Walk(v, l)
+	}
+	if r := expr.GetRight(); r != nil {
+		Walk(v, r)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Expr) bool
+
+func (f inspector) Visit(expr Expr) Visitor {
+	if f(expr) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, left side first: it starts
+// by calling f(expr). If f returns true, Inspect invokes f recursively for each
+// of the children of expr, followed by a call of f(nil).
+func Inspect(expr Expr, f func(Expr) bool) {
+	Walk(inspector(f), expr)
+}
+
+// Rewrite returns a copy of an AST in which every expression has been
+// replaced by the result of f. Children are rewritten before their parent, so
+// f sees a parent whose sides are already rewritten. Returning the expression
+// it was given leaves it unchanged. The original AST is not modified.
+func Rewrite(expr Expr, f func(Expr) Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	if expr.GetOp() != nil {
+		expr = NewBinOp(*expr.GetOp(), Rewrite(expr.GetLeft(), f), Rewrite(expr.GetRight(), f))
+	}
+	return f(expr)
+}
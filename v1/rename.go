@@ -0,0 +1,279 @@
+package hclpath
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// WithReferences makes RenameLabel and RenameAlias also rewrite the
+// traversals referring to the renamed blocks, in the edited file and in files,
+// using the naming rules of Terraform: `module.<name>`, `var.<name>`,
+// `<type>.<name>` for resources, `data.<type>.<name>` and `<provider>.<alias>`.
+// References to other blocks are left alone.
+func WithReferences(files ...*hclwrite.File) Option {
+	return func(c *config) {
+		c.references = true
+		c.referenceFiles = append(c.referenceFiles, files...)
+	}
+}
+
+// RenameLabel sets the label at index of every block matched by query to
+// label, and returns the number of blocks renamed. Nothing is edited when an
+// error is returned, such as when a block has no label at index.
+func RenameLabel(file *hclwrite.File, query string, index int, label string, opts ...Option) (count int, err error) {
+	files := referenceFiles(file, newConfig(opts))
+	err = keepFormat(files, func() error {
+		count, err = renameLabel(files, query, index, label, opts)
+		return err
+	})
+	return count, err
+}
+
+// referenceFiles lists file, followed by the other files given to
+// WithReferences.
+func referenceFiles(file *hclwrite.File, cfg *config) []*hclwrite.File {
+	files := []*hclwrite.File{file}
+	for _, f := range cfg.referenceFiles {
+		if !slices.Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// renameLabel renames the blocks of files[0], and the references to them in
+// all of files.
+func renameLabel(files []*hclwrite.File, query string, index int, label string, opts []Option) (int, error) {
+	file := files[0]
+	cfg := newConfig(opts)
+	found, err := renameTargets(file, query, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	type reference struct {
+		from, to []string
+	}
+	var refs []reference
+	for _, t := range found {
+		block := t.node.(*SyntaxNode).Block()
+		if index < 0 || index >= len(block.Labels) {
+			return 0, fmt.Errorf("block '%v' has no label at index %v", block.Type, index)
+		}
+		if !cfg.references {
+			continue
+		}
+		labels := slices.Clone(block.Labels)
+		labels[index] = label
+		from := referenceOf(block, block.Labels)
+		to := referenceOf(block, labels)
+		if from == nil || slices.Equal(from, to) {
+			continue
+		}
+		if !hclsyntax.ValidIdentifier(label) {
+			return 0, fmt.Errorf("cannot refer to block '%v' with label '%v'", block.Type, label)
+		}
+		refs = append(refs, reference{from: from, to: to})
+	}
+
+	for _, t := range found {
+		labels := t.block.Labels()
+		labels[index] = label
+		t.block.SetLabels(labels)
+	}
+	for _, ref := range refs {
+		for _, f := range files {
+			renameReferences(f.Body(), ref.from, ref.to)
+		}
+	}
+	return len(found), nil
+}
+
+// RenameType sets the type of every block matched by query to typeName, and
+// returns the number of blocks renamed.
+func RenameType(file *hclwrite.File, query string, typeName string, opts ...Option) (count int, err error) {
+	if !hclsyntax.ValidIdentifier(typeName) {
+		return 0, fmt.Errorf("invalid block type '%v'", typeName)
+	}
+	err = keepFormat([]*hclwrite.File{file}, func() error {
+		found, err := renameTargets(file, query, opts)
+		if err != nil {
+			return err
+		}
+		for _, t := range found {
+			t.block.SetType(typeName)
+		}
+		count = len(found)
+		return nil
+	})
+	return count, err
+}
+
+func renameTargets(file *hclwrite.File, query string, opts []Option) ([]target, error) {
+	found, err := targets(file, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range found {
+		if t.block == nil {
+			return nil, fmt.Errorf("cannot rename '%v', which is not a block", t.node.Type())
+		}
+	}
+	return found, nil
+}
+
+// referenceOf returns the traversal prefix other blocks refer to block with,
+// were it labelled labels, or nil when it cannot be referred to.
+func referenceOf(block *hclsyntax.Block, labels []string) []string {
+	switch {
+	case block.Type == "resource" && len(labels) == 2:
+		return labels
+	case block.Type == "data" && len(labels) == 2:
+		return []string{"data", labels[0], labels[1]}
+	case block.Type == "module" && len(labels) == 1:
+		return []string{"module", labels[0]}
+	case block.Type == "variable" && len(labels) == 1:
+		return []string{"var", labels[0]}
+	case block.Type == "provider" && len(labels) == 1:
+		attr, ok := block.Body.Attributes["alias"]
+		if !ok {
+			return nil
+		}
+		alias, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || alias.IsNull() || alias.Type() != cty.String {
+			return nil
+		}
+		return []string{labels[0], alias.AsString()}
+	}
+	return nil
+}
+
+func renameReferences(body *hclwrite.Body, from, to []string) {
+	for _, a := range body.Attributes() {
+		a.Expr().RenameVariablePrefix(from, to)
+	}
+	for _, b := range body.Blocks() {
+		renameReferences(b.Body(), from, to)
+	}
+}
+
+// RenameAlias sets the alias of every provider block matched by query to
+// alias, adding one to default providers, and returns the number of providers
+// renamed. With WithReferences, the `provider` arguments and the values of the
+// `providers` maps referring to them, as `<provider>.<alias>` or as
+// `<provider>` for default providers, are rewritten as well. Resources relying
+// on a default provider without referring to it are left alone.
+func RenameAlias(file *hclwrite.File, query string, alias string, opts ...Option) (count int, err error) {
+	if !hclsyntax.ValidIdentifier(alias) {
+		return 0, fmt.Errorf("invalid alias '%v'", alias)
+	}
+	cfg := newConfig(opts)
+	files := referenceFiles(file, cfg)
+	err = keepFormat(files, func() error {
+		found, err := renameTargets(file, query, opts)
+		if err != nil {
+			return err
+		}
+		var refs [][]string
+		for _, t := range found {
+			block := t.node.(*SyntaxNode).Block()
+			if block.Type != "provider" || len(block.Labels) != 1 {
+				return fmt.Errorf("block '%v' is not a provider", block.Type)
+			}
+			from := block.Labels
+			if ref := referenceOf(block, block.Labels); ref != nil {
+				from = ref
+			} else if _, ok := block.Body.Attributes["alias"]; ok {
+				return fmt.Errorf("provider '%v' has an alias that is not a string", block.Labels[0])
+			}
+			refs = append(refs, from)
+		}
+
+		for _, t := range found {
+			t.body.SetAttributeValue("alias", cty.StringVal(alias))
+		}
+		count = len(found)
+		if !cfg.references {
+			return nil
+		}
+		for _, f := range files {
+			if err := renameProviderReferences(f, refs, alias); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// renameProviderReferences points the references of file to any of the
+// providers refs to the alias of the same provider.
+func renameProviderReferences(file *hclwrite.File, refs [][]string, alias string) error {
+	source := Bytes(file)
+	parsed, diags := hclsyntax.ParseConfig(source, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse file: %v", diags)
+	}
+	var splices []splice
+	var walk func(body *hclsyntax.Body)
+	walk = func(body *hclsyntax.Body) {
+		for _, a := range body.Attributes {
+			var exprs []hclsyntax.Expression
+			switch a.Name {
+			case "provider":
+				exprs = append(exprs, a.Expr)
+			case "providers":
+				if obj, ok := a.Expr.(*hclsyntax.ObjectConsExpr); ok {
+					for _, item := range obj.Items {
+						exprs = append(exprs, item.ValueExpr)
+					}
+				}
+			}
+			for _, expr := range exprs {
+				trav, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+				if !ok {
+					continue
+				}
+				for _, ref := range refs {
+					if traversalIs(trav.Traversal, ref) {
+						rng := trav.SrcRange
+						splices = append(splices, splice{
+							offset: rng.Start.Byte,
+							size:   rng.End.Byte - rng.Start.Byte,
+							text:   ref[0] + "." + alias,
+						})
+						break
+					}
+				}
+			}
+		}
+		for _, b := range body.Blocks {
+			walk(b.Body)
+		}
+	}
+	walk(parsed.Body.(*hclsyntax.Body))
+	if len(splices) == 0 {
+		return nil
+	}
+	return applySplices(file, source, splices)
+}
+
+// traversalIs reports whether trav is exactly the traversal names, such as
+// `aws.west` for ["aws", "west"].
+func traversalIs(trav hcl.Traversal, names []string) bool {
+	if len(trav) != len(names) || trav.RootName() != names[0] {
+		return false
+	}
+	for i, step := range trav[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok || attr.Name != names[i+1] {
+			return false
+		}
+	}
+	return true
+}
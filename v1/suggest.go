@@ -0,0 +1,118 @@
+package hclpath
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/agext/levenshtein"
+)
+
+const (
+	// maxCandidates bounds the number of names gathered for each step of a
+	// query.
+	maxCandidates = 64
+	// maxDistance is the edit distance below which a name is suggested.
+	maxDistance = 3
+)
+
+// Suggestion lists the names close to one that a query step was looking for
+// and did not find.
+type Suggestion struct {
+	// Kind is one of "block type", "label" or "attribute".
+	Kind  string
+	Given string
+	// Names are nearest first.
+	Names []string
+}
+
+func (s Suggestion) String() string {
+	quoted := make([]string, len(s.Names))
+	for i, n := range s.Names {
+		quoted[i] = fmt.Sprintf("'%v'", n)
+	}
+	return fmt.Sprintf("no %v '%v' found, did you mean %v?", s.Kind, s.Given, strings.Join(quoted, " or "))
+}
+
+// candidates gathers the names a step met while it had yet to match anything.
+type candidates struct {
+	kind     string
+	given    string
+	names    []string
+	produced bool
+}
+
+// consider gathers the names returned by names as candidates for a step that
+// has not matched anything yet. names is only called when needed.
+func (r *run) consider(e *evaluation, kind string, given string, names func() []string) {
+	c := r.candidatesOf(e, kind, given)
+	if c.produced || len(c.names) >= maxCandidates {
+		return
+	}
+	for _, n := range names() {
+		if len(c.names) < maxCandidates && !slices.Contains(c.names, n) {
+			c.names = append(c.names, n)
+		}
+	}
+}
+
+// produced marks a step as having matched, so it needs no suggestions.
+func (r *run) produced(e *evaluation) {
+	if c, ok := r.candidates[e]; ok {
+		c.produced = true
+		c.names = nil
+		return
+	}
+	r.candidates[e] = &candidates{produced: true}
+	r.steps = append(r.steps, e)
+}
+
+func (r *run) candidatesOf(e *evaluation, kind string, given string) *candidates {
+	c, ok := r.candidates[e]
+	if !ok {
+		c = &candidates{}
+		r.candidates[e] = c
+		r.steps = append(r.steps, e)
+	}
+	c.kind, c.given = kind, given
+	return c
+}
+
+// suggestions lists, for every step that matched nothing, the names it met
+// that are close to the one it was looking for.
+func (r *run) suggestions() []Suggestion {
+	suggestions := []Suggestion{}
+	for _, e := range r.steps {
+		c := r.candidates[e]
+		if c.produced {
+			continue
+		}
+		distances := map[string]int{}
+		names := []string{}
+		for _, n := range c.names {
+			d := levenshtein.Distance(strings.ToLower(c.given), strings.ToLower(n), nil)
+			if d < maxDistance && n != c.given {
+				distances[n] = d
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		slices.SortStableFunc(names, func(a, b string) int {
+			return distances[a] - distances[b]
+		})
+		suggestions = append(suggestions, Suggestion{Kind: c.kind, Given: c.given, Names: names})
+	}
+	return suggestions
+}
+
+func attributeNames(b Node) []string {
+	attrs, _ := b.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
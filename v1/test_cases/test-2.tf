@@ -0,0 +1,8 @@
+provider "aws" {
+  alias  = "prod-account"
+  region = "eu-west-1"
+}
+
+resource "aws_iam_role" "deployer" {
+  name = "deployer"
+}
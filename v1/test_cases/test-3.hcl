@@ -0,0 +1,17 @@
+source "amazon-ebs" "ubuntu" {
+  region = "eu-west-1"
+}
+
+build {
+  sources = ["source.amazon-ebs.ubuntu"]
+}
+
+provider "aws.west" {
+  region = "us-west-2"
+}
+
+job "dépôt nocturne" {
+  tâche "café" {
+    driver = "docker"
+  }
+}
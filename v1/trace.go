@@ -0,0 +1,153 @@
+package hclpath
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kdehairy/hclpath/v2/parse"
+)
+
+// traceSamples is the number of dropped blocks kept by each step of a trace.
+const traceSamples = 3
+
+// Trace records how a step of a query, one node of its AST, went through an
+// execution. Steps are nested like the AST, Left and Right being nil for
+// leaves and for steps that were never evaluated.
+type Trace struct {
+	Expr parse.Expr
+	// In is the number of blocks the step was fed.
+	In int
+	// Out is the number of blocks the step yielded.
+	Out int
+	// Elapsed is the time spent in the step, including its sub steps but not
+	// the steps feeding it.
+	Elapsed time.Duration
+	// Dropped holds a sample of the blocks a filtering step did not yield.
+	Dropped Nodes
+	Left    *Trace
+	Right   *Trace
+}
+
+// String renders the trace as a tree, one line per step, each labeled with the
+// Print() form of its node.
+func (t *Trace) String() string {
+	var sb strings.Builder
+	t.write(&sb, "", "")
+	return sb.String()
+}
+
+func (t *Trace) write(sb *strings.Builder, prefix string, childPrefix string) {
+	fmt.Fprintf(sb, "%v%v  in=%v out=%v time=%v\n", prefix, t.Expr.Print(), t.In, t.Out, t.Elapsed)
+	children := []*Trace{}
+	for _, c := range []*Trace{t.Left, t.Right} {
+		if c != nil {
+			children = append(children, c)
+		}
+	}
+	for _, d := range t.Dropped {
+		if len(children) > 0 {
+			fmt.Fprintf(sb, "%v│  dropped: %v\n", childPrefix, describe(d))
+		} else {
+			fmt.Fprintf(sb, "%v   dropped: %v\n", childPrefix, describe(d))
+		}
+	}
+	for i, c := range children {
+		if i == len(children)-1 {
+			c.write(sb, childPrefix+"└─ ", childPrefix+"   ")
+		} else {
+			c.write(sb, childPrefix+"├─ ", childPrefix+"│  ")
+		}
+	}
+}
+
+func describe(n Node) string {
+	var sb strings.Builder
+	sb.WriteString(n.Type())
+	for _, l := range n.Labels() {
+		fmt.Fprintf(&sb, " %q", l)
+	}
+	fmt.Fprintf(&sb, " (%v)", n.DefRange())
+	return sb.String()
+}
+
+// WithTrace records a Trace of every execution on its Result.
+func WithTrace() Option {
+	return func(c *config) {
+		c.trace = true
+	}
+}
+
+// traced wraps do so that, when the run is traced, the blocks going in and out
+// of the step and the time spent in it are recorded.
+func traced(e *evaluation, do evalFunc) evalFunc {
+	return func(r *run, in stream) stream {
+		if r.traces == nil {
+			return do(r, in)
+		}
+		t := r.traceOf(e)
+		// time spent producing the input belongs to the steps feeding this
+		// one, so it is taken off.
+		counted := func(yield func(item, error) bool) {
+			start := time.Now()
+			for b, err := range in {
+				t.Elapsed -= time.Since(start)
+				if err == nil {
+					t.In++
+				}
+				if !yield(b, err) {
+					return
+				}
+				start = time.Now()
+			}
+			t.Elapsed -= time.Since(start)
+		}
+		return func(yield func(item, error) bool) {
+			start := time.Now()
+			for b, err := range do(r, counted) {
+				t.Elapsed += time.Since(start)
+				if err == nil {
+					t.Out++
+				}
+				if !yield(b, err) {
+					return
+				}
+				start = time.Now()
+			}
+			t.Elapsed += time.Since(start)
+		}
+	}
+}
+
+func (r *run) traceOf(e *evaluation) *Trace {
+	t, ok := r.traces[e]
+	if !ok {
+		t = &Trace{Expr: e.expr}
+		r.traces[e] = t
+	}
+	return t
+}
+
+func (r *run) drop(e *evaluation, n Node) {
+	if r.traces == nil {
+		return
+	}
+	t := r.traceOf(e)
+	if len(t.Dropped) < traceSamples {
+		t.Dropped = append(t.Dropped, n)
+	}
+}
+
+// buildTrace assembles the traces recorded for e and its sides into a tree.
+func (r *run) buildTrace(e *evaluation) *Trace {
+	if e == nil {
+		return nil
+	}
+	t, ok := r.traces[e]
+	if !ok {
+		return nil
+	}
+	t.Left = r.buildTrace(e.lhs)
+	t.Right = r.buildTrace(e.rhs)
+	return t
+}
@@ -115,7 +115,7 @@ func TestObjType(t *testing.T) {
 			if len(blocks) != 1 {
 				t.Fatalf("expected 1 but found %v blocks", len(blocks))
 			}
-			passed, err := tc.test(blocks[0], tc.attr)
+			passed, err := tc.test(blocks[0].(*hclpath.SyntaxNode).Block(), tc.attr)
 			if err != nil {
 				t.Fatalf("failed: %v", err)
 			}
@@ -159,7 +159,7 @@ func TestStringType(t *testing.T) {
 			}
 
 			for _, b := range blocks {
-				block := New(b)
+				block := New(b.(*hclpath.SyntaxNode).Block())
 				var str string
 				attr, err := block.GetAttr(tc.attr)
 				attr.To(&str, nil)